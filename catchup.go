@@ -0,0 +1,98 @@
+package goflow
+
+import (
+	"log"
+	"time"
+)
+
+// A CatchupPolicy decides which of the runs of a job that were missed
+// while Goflow was down are run at startup.
+type CatchupPolicy string
+
+const (
+	// CatchupNone doesn't run the missed runs. This is the default.
+	CatchupNone CatchupPolicy = "none"
+	// CatchupLatest runs only the most recent missed run.
+	CatchupLatest CatchupPolicy = "latest"
+	// CatchupAll runs all the missed runs, one at a time, in order.
+	CatchupAll CatchupPolicy = "all"
+)
+
+// valid returns false if the catch-up policy is unknown.
+func (p CatchupPolicy) valid() bool {
+	switch p {
+	case "", CatchupNone, CatchupLatest, CatchupAll:
+		return true
+	}
+	return false
+}
+
+// catchUp submits the runs of the active jobs that were missed since the
+// interval of their last execution, according to their catch-up policy.
+// Jobs without an execution that covers an interval are not caught up.
+func (g *Goflow) catchUp() {
+	now := time.Now()
+
+	for _, jobName := range g.jobs {
+		j := g.Jobs[jobName]()
+		if j.Catchup == "" || j.Catchup == CatchupNone || !g.isActive(jobName) {
+			continue
+		}
+
+		last, ok, err := lastIntervalEnd(g, jobName)
+		if err != nil {
+			log.Printf("job=%v, msg=catch-up failed, error=%v", jobName, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		s, err := g.parser.Parse(j.Schedule)
+		if err != nil {
+			log.Printf("job=%v, msg=catch-up failed, error=%v", jobName, err)
+			continue
+		}
+
+		intervals, err := intervalsBetween(s, last, now, maxBackfill)
+		if err != nil {
+			log.Printf("job=%v, msg=catch-up failed, error=%v", jobName, err)
+			continue
+		}
+		if len(intervals) == 0 {
+			continue
+		}
+		if j.Catchup == CatchupLatest {
+			intervals = intervals[len(intervals)-1:]
+		}
+
+		log.Printf("job=%v, msg=catching up %d missed runs", jobName, len(intervals))
+		if _, err := g.runIntervals(j, intervals, 1); err != nil {
+			log.Printf("job=%v, msg=catch-up failed, error=%v", jobName, err)
+		}
+	}
+}
+
+// lastIntervalEnd returns the latest end of the intervals covered by the
+// stored executions of a job. The executions are read from the most
+// recent, until one was submitted before the latest end found so far: the
+// interval of a run ends before it is submitted, so the older runs can't
+// cover a later one.
+func lastIntervalEnd(g *Goflow, jobName string) (time.Time, bool, error) {
+	var last time.Time
+	err := eachExecution(g.Executions, ExecutionQuery{Jobs: []string{jobName}}, func(e *Execution) bool {
+		submitted, err := time.Parse(time.RFC3339Nano, e.StartedAt)
+		if err == nil && !last.IsZero() && submitted.Before(last) {
+			return false
+		}
+		end, err := time.Parse(time.RFC3339, e.IntervalEnd)
+		if err == nil && end.After(last) {
+			last = end
+		}
+		return true
+	})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return last, !last.IsZero(), nil
+}
@@ -0,0 +1,57 @@
+package goflow
+
+import (
+	"testing"
+	"time"
+)
+
+func hourlyJob(policy CatchupPolicy) func() *Job {
+	return func() *Job {
+		j := &Job{Name: "hourly-" + string(policy), Schedule: "0 * * * *", Active: true, Catchup: policy}
+		j.Add(&Task{Name: "true", Operator: Command{Cmd: "true"}})
+		return j
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	cases := map[CatchupPolicy]int{CatchupNone: 0, CatchupLatest: 1, CatchupAll: 3}
+
+	for policy, expected := range cases {
+		g := New(Options{})
+		if err := g.AddJob(hourlyJob(policy)); err != nil {
+			t.Fatal(err)
+		}
+
+		// the last run covered the interval ending three ticks ago
+		j := g.Jobs["hourly-"+string(policy)]()
+		last := time.Now().Truncate(time.Hour).Add(-3 * time.Hour)
+		e := j.newExecution(nil)
+		e.setInterval(interval{last.Add(-time.Hour), last})
+		e.State = StateSuccessful
+		saveNewExecution(g.Executions, e)
+
+		g.catchUp()
+
+		executions, _ := readExecutions(g.Executions, j.Name)
+		if len(executions) != expected+1 {
+			t.Errorf("Got %d executions with policy %s, expected %d", len(executions), policy, expected+1)
+		}
+		if policy == CatchupLatest && executions[1].IntervalEnd != time.Now().Truncate(time.Hour).UTC().Format(time.RFC3339) {
+			t.Errorf("Got interval end %v, expected the latest tick", executions[1].IntervalEnd)
+		}
+
+		// wait for the missed runs to finish
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			if last, _, _ := g.Executions.Get(executions[len(executions)-1].ID); last.State.finished() {
+				break
+			}
+		}
+		g.wg.Wait()
+	}
+}
+
+func TestInvalidCatchupPolicy(t *testing.T) {
+	if err := hourlyJob("sometimes")().Validate(); err == nil {
+		t.Errorf("Expected an error for an unknown catch-up policy")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package goflow
+
+import "os/exec"
+
+// setProcessGroup does nothing on this platform, only the command itself
+// is killed when the context is done.
+func setProcessGroup(cmd *exec.Cmd) {}
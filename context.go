@@ -0,0 +1,29 @@
+package goflow
+
+import "context"
+
+type contextKey int
+
+const (
+	upstreamResultsKey contextKey = iota
+	taskOutputKey
+	paramsKey
+	templateDataKey
+)
+
+// UpstreamResults returns the results of the tasks immediately upstream of
+// the task being run, keyed by task name. It is meant to be called from
+// the RunContext() method of a ContextOperator. Results of tasks that did
+// not succeed are nil.
+//
+// Results are also persisted with the execution. When an execution is
+// resumed from the store, results have the types produced by the store's
+// codec: with the default JSON codec, numbers become float64 and structs
+// become map[string]interface{}.
+func UpstreamResults(ctx context.Context) map[string]interface{} {
+	results, ok := ctx.Value(upstreamResultsKey).(map[string]interface{})
+	if !ok {
+		return make(map[string]interface{})
+	}
+	return results
+}
@@ -1,6 +1,8 @@
 package goflow
 
 import (
+	"sort"
+
 	"github.com/ef-ds/deque"
 )
 
@@ -39,6 +41,12 @@ func (d dag) isDownstream(nodeName string) bool {
 
 // Ensure the DAG is acyclic
 func (d dag) validate() bool {
+	return len(d.cycle()) == 0
+}
+
+// Return the nodes that are part of a cycle, or that sit between two
+// cycles. The result is empty if the DAG is acyclic.
+func (d dag) cycle() []string {
 	degree := make(map[string]int)
 
 	for node := range d {
@@ -59,7 +67,7 @@ func (d dag) validate() bool {
 		}
 	}
 
-	l := make([]string, 0)
+	sorted := make(map[string]bool)
 
 	for {
 		popped, ok := deq.PopBack()
@@ -68,7 +76,7 @@ func (d dag) validate() bool {
 			break
 		} else {
 			node := popped.(string)
-			l = append(l, node)
+			sorted[node] = true
 			dsNodes := d[node]
 			for _, dsNode := range dsNodes {
 				degree[dsNode]--
@@ -79,7 +87,39 @@ func (d dag) validate() bool {
 		}
 	}
 
-	return len(l) == len(d)
+	// The nodes left over are in a cycle or downstream of one. Prune the
+	// ones that don't lead back into a cycle.
+	for {
+		pruned := false
+		for node := range d {
+			if sorted[node] {
+				continue
+			}
+			leadsBack := false
+			for _, dsNode := range d[node] {
+				if !sorted[dsNode] {
+					leadsBack = true
+				}
+			}
+			if !leadsBack {
+				sorted[node] = true
+				pruned = true
+			}
+		}
+		if !pruned {
+			break
+		}
+	}
+
+	nodes := make([]string, 0)
+	for node := range d {
+		if !sorted[node] {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+
+	return nodes
 }
 
 // Return the immediately upstream nodes for a given node
@@ -98,6 +138,58 @@ func (d dag) dependencies(node string) []string {
 	return dependencies
 }
 
+// Return all the nodes downstream of a given node, directly or not
+func (d dag) descendants(node string) []string {
+
+	descendants := make([]string, 0)
+	seen := make(map[string]bool)
+
+	var deq deque.Deque
+	deq.PushFront(node)
+
+	for {
+		popped, ok := deq.PopBack()
+		if !ok {
+			break
+		}
+		for _, ds := range d[popped.(string)] {
+			if !seen[ds] {
+				seen[ds] = true
+				descendants = append(descendants, ds)
+				deq.PushFront(ds)
+			}
+		}
+	}
+
+	return descendants
+}
+
+// Return all the nodes upstream of a given node, directly or not
+func (d dag) ancestors(node string) []string {
+
+	ancestors := make([]string, 0)
+	seen := make(map[string]bool)
+
+	var deq deque.Deque
+	deq.PushFront(node)
+
+	for {
+		popped, ok := deq.PopBack()
+		if !ok {
+			break
+		}
+		for _, us := range d.dependencies(popped.(string)) {
+			if !seen[us] {
+				seen[us] = true
+				ancestors = append(ancestors, us)
+				deq.PushFront(us)
+			}
+		}
+	}
+
+	return ancestors
+}
+
 // Return all the independent nodes in the graph
 func (d dag) independentNodes() []string {
 
@@ -1,6 +1,7 @@
 package goflow
 
 import (
+	"sort"
 	"testing"
 )
 
@@ -56,3 +57,63 @@ func TestDagWithSingleNode(t *testing.T) {
 	}
 
 }
+
+func TestDagCycle(t *testing.T) {
+	d := make(dag)
+
+	d.addNode("a")
+	d.addNode("b")
+	d.addNode("c")
+	d.addNode("d")
+	d.addNode("e")
+	d.setDownstream("a", "b")
+	d.setDownstream("b", "c")
+	d.setDownstream("c", "b")
+	d.setDownstream("c", "d")
+
+	if !equal(d.cycle(), []string{"b", "c"}) {
+		t.Errorf("d.cycle() returned %s, expected %s", d.cycle(), []string{"b", "c"})
+	}
+}
+
+func TestDagDescendants(t *testing.T) {
+	d := make(dag)
+
+	d.addNode("a")
+	d.addNode("b")
+	d.addNode("c")
+	d.addNode("d")
+	d.setDownstream("a", "b")
+	d.setDownstream("b", "c")
+	d.setDownstream("a", "c")
+
+	if !equal(d.descendants("a"), []string{"b", "c"}) {
+		t.Errorf("d.descendants() returned %s, expected %s", d.descendants("a"), []string{"b", "c"})
+	}
+
+	if !equal(d.descendants("d"), []string{}) {
+		t.Errorf("d.descendants() returned %s, expected %s", d.descendants("d"), []string{})
+	}
+}
+
+func TestDagAncestors(t *testing.T) {
+	d := make(dag)
+
+	d.addNode("a")
+	d.addNode("b")
+	d.addNode("c")
+	d.addNode("d")
+	d.setDownstream("a", "b")
+	d.setDownstream("b", "c")
+	d.setDownstream("a", "c")
+
+	ancestors := d.ancestors("c")
+	sort.Strings(ancestors)
+	if !equal(ancestors, []string{"a", "b"}) {
+		t.Errorf("d.ancestors() returned %s, expected %s", ancestors, []string{"a", "b"})
+	}
+
+	if !equal(d.ancestors("d"), []string{}) {
+		t.Errorf("d.ancestors() returned %s, expected %s", d.ancestors("d"), []string{})
+	}
+}
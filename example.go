@@ -48,12 +48,12 @@ func complexAnalyticsJob() *Job {
 	j.Add(&Task{
 		Name:        "totally-skippable",
 		Operator:    Command{Cmd: "sh", Args: []string{"-c", "echo 'everything succeeded'"}},
-		TriggerRule: "allSuccessful",
+		TriggerRule: AllSuccessful,
 	})
 	j.Add(&Task{
 		Name:        "clean-up",
 		Operator:    Command{Cmd: "sh", Args: []string{"-c", "echo 'cleaning up now'"}},
-		TriggerRule: "allDone",
+		TriggerRule: AllDone,
 	})
 
 	j.SetDownstream(j.Task("sleep-one"), j.Task("add-one-one"))
@@ -92,3 +92,16 @@ func customOperatorJob() *Job {
 	j.Add(&Task{Name: "random-failure", Operator: RandomFailure{4}})
 	return j
 }
+
+// exampleJob adapts the schedule of an example job, which runs every
+// second, to a parser without the seconds field.
+func exampleJob(fn func() *Job, withSeconds bool) func() *Job {
+	if withSeconds {
+		return fn
+	}
+	return func() *Job {
+		j := fn()
+		j.Schedule = "* * * * *"
+		return j
+	}
+}
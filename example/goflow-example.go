@@ -1,6 +1,13 @@
 package main
 
 import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/fieldryand/goflow/v2"
 )
 
@@ -12,5 +19,19 @@ func main() {
 	}
 	gf := goflow.New(options)
 	gf.Use(goflow.DefaultLogger())
-	gf.Run(":8181")
+
+	// shut down gracefully on SIGINT or SIGTERM
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+		<-stop
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		gf.Shutdown(ctx)
+	}()
+
+	if err := gf.Run(":8181"); err != nil {
+		log.Fatal(err)
+	}
 }
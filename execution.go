@@ -1,92 +1,154 @@
 package goflow
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/philippgille/gokv"
 )
 
 // Execution of a job.
-type execution struct {
-	ID                uuid.UUID       `json:"id"`
-	JobName           string          `json:"job"`
-	StartedAt         string          `json:"submitted"`
-	ModifiedTimestamp string          `json:"modifiedTimestamp"`
-	State             state           `json:"state"`
-	TaskExecutions    []taskExecution `json:"tasks"`
+type Execution struct {
+	ID                uuid.UUID              `json:"id"`
+	JobName           string                 `json:"job"`
+	StartedAt         string                 `json:"submitted"`
+	ModifiedTimestamp string                 `json:"modifiedTimestamp"`
+	State             State                  `json:"state"`
+	Params            map[string]interface{} `json:"params,omitempty"`
+	IntervalStart     string                 `json:"intervalStart,omitempty"`
+	IntervalEnd       string                 `json:"intervalEnd,omitempty"`
+	TaskExecutions    []TaskExecution        `json:"tasks"`
 }
 
-type taskExecution struct {
-	Name  string `json:"name"`
-	State state  `json:"state"`
+// A TaskExecution is the state of a task within an execution.
+type TaskExecution struct {
+	Name     string        `json:"name"`
+	State    State         `json:"state"`
+	Error    string        `json:"error,omitempty"`
+	Result   interface{}   `json:"result,omitempty"`
+	Attempts []TaskAttempt `json:"attempts,omitempty"`
 }
 
-func (j *Job) newExecution() *execution {
-	taskExecutions := make([]taskExecution, 0)
+// A TaskAttempt records one run of a task's operator.
+type TaskAttempt struct {
+	Attempt    int               `json:"attempt"`
+	State      State             `json:"state"`
+	StartedAt  string            `json:"startedAt"`
+	EndedAt    string            `json:"endedAt,omitempty"`
+	DurationMs int64             `json:"durationMs"`
+	Stdout     string            `json:"stdout,omitempty"`
+	Stderr     string            `json:"stderr,omitempty"`
+	ExitCode   *int              `json:"exitCode,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Rendered   map[string]string `json:"rendered,omitempty"`
+}
+
+func (j *Job) newExecution(params map[string]interface{}) *Execution {
+	taskExecutions := make([]TaskExecution, 0)
 	for _, task := range j.Tasks {
-		taskrun := taskExecution{task.Name, none}
+		taskrun := TaskExecution{Name: task.Name, State: StateNotStarted}
 		taskExecutions = append(taskExecutions, taskrun)
 	}
-	return &execution{
+	return &Execution{
 		ID:                uuid.New(),
 		JobName:           j.Name,
 		StartedAt:         time.Now().UTC().Format(time.RFC3339Nano),
 		ModifiedTimestamp: time.Now().UTC().Format(time.RFC3339Nano),
-		State:             none,
+		State:             StateNotStarted,
+		Params:            params,
 		TaskExecutions:    taskExecutions}
 }
 
-// Persist a new execution.
-func persistNewExecution(s gokv.Store, e *execution) error {
-	key := e.ID
-	return s.Set(key.String(), e)
+// withoutLogs returns a copy of the execution without the stdout and
+// stderr of its task attempts, which are only served by the logs route.
+func (e *Execution) withoutLogs() *Execution {
+	c := *e
+	c.TaskExecutions = make([]TaskExecution, len(e.TaskExecutions))
+	for ix, task := range e.TaskExecutions {
+		attempts := make([]TaskAttempt, len(task.Attempts))
+		for ia, a := range task.Attempts {
+			a.Stdout = ""
+			a.Stderr = ""
+			attempts[ia] = a
+		}
+		task.Attempts = attempts
+		c.TaskExecutions[ix] = task
+	}
+	return &c
 }
 
-type executionIndex struct {
-	ExecutionIDs []string `json:"executions"`
+// saveNewExecution persists a new execution.
+func saveNewExecution(s ExecutionStore, e *Execution) error {
+	if err := s.Save(e); err != nil {
+		return storeError{fmt.Errorf("Failed to save execution %s: %v", e.ID, err)}
+	}
+	return nil
 }
 
-// Index the job runs
-func indexExecutions(s gokv.Store, e *execution) error {
-
-	// get the job from the execution
-	j := e.JobName
-
-	// retrieve the list of executions of that job
-	i := executionIndex{}
-	s.Get(j, &i)
-
-	// append to the list
-	i.ExecutionIDs = append(i.ExecutionIDs, e.ID.String())
-	return s.Set(e.JobName, i)
+// Persist the current state of an execution.
+func persistExecution(s ExecutionStore, e *Execution) error {
+	e.ModifiedTimestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	return s.Save(e)
 }
 
-// Read all the persisted executions for a given job.
-func readExecutions(s gokv.Store, j string) ([]*execution, error) {
-
-	// retrieve the list of executions of the job
-	i := executionIndex{}
-	s.Get(j, &i)
-
-	// return the list
-	executions := make([]*execution, 0)
-	for _, key := range i.ExecutionIDs {
-		val := execution{}
-		s.Get(key, &val)
-		executions = append(executions, &val)
+// listBatch is the number of executions read at a time when walking
+// through the store.
+const listBatch = 100
+
+// eachExecution calls fn with each execution selected by the query, most
+// recent first, reading them a page at a time. It stops early if fn
+// returns false.
+func eachExecution(s ExecutionStore, q ExecutionQuery, fn func(*Execution) bool) error {
+	q.Limit = listBatch
+	for {
+		executions, next, err := s.List(q)
+		if err != nil {
+			return err
+		}
+		for _, e := range executions {
+			if !fn(e) {
+				return nil
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		q.Cursor = next
 	}
-
-	return executions, nil
 }
 
 // Sync the current state to the persisted execution.
-func syncStateToStore(s gokv.Store, e *execution, taskName string, taskState state) error {
-	key := e.ID
+func syncStateToStore(s ExecutionStore, e *Execution, write writeOp) error {
 	for ix, task := range e.TaskExecutions {
+		if task.Name == write.key {
+			e.TaskExecutions[ix].State = write.val
+			e.TaskExecutions[ix].Error = write.err
+			e.TaskExecutions[ix].Result = write.result
+			if write.attempt != nil {
+				e.TaskExecutions[ix].Attempts = syncAttempt(e.TaskExecutions[ix].Attempts, *write.attempt)
+			}
+		}
+	}
+	return s.Save(e)
+}
+
+// Add an attempt to the list, or replace it if it is already there.
+func syncAttempt(attempts []TaskAttempt, attempt TaskAttempt) []TaskAttempt {
+	for ix, a := range attempts {
+		if a.Attempt == attempt.Attempt {
+			attempts[ix] = attempt
+			return attempts
+		}
+	}
+	return append(attempts, attempt)
+}
+
+// Return the number of the next attempt of a task.
+func (e *Execution) nextAttempt(taskName string) int {
+	for _, task := range e.TaskExecutions {
 		if task.Name == taskName {
-			e.TaskExecutions[ix].State = taskState
+			return len(task.Attempts) + 1
 		}
 	}
-	return s.Set(key.String(), e)
+	return 1
 }
@@ -0,0 +1,160 @@
+package goflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExportVersion is the version of the format written by Export. Import
+// reads this version and the earlier ones.
+const ExportVersion = 1
+
+// exportBatch is the number of executions read at a time by Export.
+const exportBatch = 100
+
+// An exportHeader is the first line of an export.
+type exportHeader struct {
+	Format   string `json:"format"`
+	Version  int    `json:"version"`
+	Exported string `json:"exported"`
+}
+
+const exportFormat = "goflow-executions"
+
+var errInvalidExport = errors.New("Invalid export, the first line must be a goflow-executions header")
+
+const errExportedUnfinished = "The execution was exported before it finished"
+
+// ImportResult counts the executions saved by Import.
+type ImportResult struct {
+	// Imported is the number of executions saved.
+	Imported int `json:"imported"`
+	// Cancelled is the number of executions that were still running when
+	// they were exported. Their unfinished tasks are saved as cancelled,
+	// so that they are not recovered as if they had been interrupted.
+	Cancelled int `json:"cancelled"`
+}
+
+// Export writes the executions of the given jobs, or of all the jobs if
+// none are given, as newline-delimited JSON: a header with the version of
+// the format, then one execution per line, most recent first. It returns
+// the number of executions written. The index is not exported, the store
+// rebuilds it on import.
+func Export(w io.Writer, s ExecutionStore, jobs ...string) (int, error) {
+	enc := json.NewEncoder(w)
+	header := exportHeader{
+		Format:   exportFormat,
+		Version:  ExportVersion,
+		Exported: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if err := enc.Encode(header); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	q := ExecutionQuery{Jobs: jobs, Limit: exportBatch}
+	for {
+		executions, next, err := s.List(q)
+		if err != nil {
+			return n, storeError{err}
+		}
+		for _, e := range executions {
+			if err := enc.Encode(e); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if next == "" {
+			return n, nil
+		}
+		q.Cursor = next
+	}
+}
+
+// Import reads executions written by Export and saves them in a store,
+// replacing the executions with the same IDs. Executions exported by
+// earlier versions of the format are upgraded, and executions that hadn't
+// finished are cancelled. It returns the number of executions saved.
+func Import(r io.Reader, s ExecutionStore) (ImportResult, error) {
+	dec := json.NewDecoder(r)
+	result := ImportResult{}
+
+	header := exportHeader{}
+	if err := dec.Decode(&header); err != nil || header.Format != exportFormat {
+		return result, errInvalidExport
+	}
+	if header.Version < 1 || header.Version > ExportVersion {
+		return result, fmt.Errorf("Unsupported export version %d, expected at most %d", header.Version, ExportVersion)
+	}
+
+	for {
+		line := result.Imported + 2
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, fmt.Errorf("Invalid execution on line %d: %v", line, err)
+		}
+
+		e, err := upgradeExecution(header.Version, raw)
+		if err != nil {
+			return result, fmt.Errorf("Invalid execution on line %d: %v", line, err)
+		}
+		unfinished := !e.State.finished()
+		if unfinished {
+			cancelExported(e)
+		}
+		if err := s.Save(e); err != nil {
+			return result, storeError{fmt.Errorf("Failed to save execution %s: %v", e.ID, err)}
+		}
+		result.Imported++
+		if unfinished {
+			result.Cancelled++
+		}
+	}
+}
+
+// cancelExported marks the unfinished attempts and tasks of an execution
+// that was exported while it was running as cancelled.
+func cancelExported(e *Execution) {
+	for ix, task := range e.TaskExecutions {
+		for jx, a := range task.Attempts {
+			if !a.State.finished() && a.State != StateUpForRetry {
+				e.TaskExecutions[ix].Attempts[jx].State = StateCancelled
+				e.TaskExecutions[ix].Attempts[jx].Error = errExportedUnfinished
+			}
+		}
+		if !task.State.finished() {
+			e.TaskExecutions[ix].State = StateCancelled
+			e.TaskExecutions[ix].Error = errExportedUnfinished
+		}
+	}
+	e.State = StateCancelled
+}
+
+// upgradeExecution reads an execution exported with a version of the
+// format. When the format changes, the earlier versions are converted
+// here, one version at a time.
+func upgradeExecution(version int, raw json.RawMessage) (*Execution, error) {
+	e := Execution{}
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return nil, err
+	}
+	if e.ID == uuid.Nil {
+		return nil, errors.New("Execution has no ID")
+	}
+	if e.JobName == "" {
+		return nil, errors.New("Execution has no job")
+	}
+	if _, err := time.Parse(time.RFC3339Nano, e.StartedAt); err != nil {
+		return nil, fmt.Errorf("Invalid submission time %s", e.StartedAt)
+	}
+	return &e, nil
+}
@@ -0,0 +1,158 @@
+package goflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/philippgille/gokv/gomap"
+)
+
+func TestExportImport(t *testing.T) {
+	from := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := storeExecutions(from, "a", start, start.Add(time.Hour))
+	b := storeExecutions(from, "b", start.Add(time.Minute))
+	a[0].Params = map[string]interface{}{"name": "x"}
+	a[0].TaskExecutions[0].Attempts = []TaskAttempt{{Attempt: 1, State: StateSuccessful, Stdout: "hello\n"}}
+	persistExecution(from, a[0])
+
+	var buf bytes.Buffer
+	if n, err := Export(&buf, from); err != nil || n != 3 {
+		t.Fatalf("Exported %d executions, expected 3, error: %v", n, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	header := exportHeader{}
+	json.Unmarshal([]byte(lines[0]), &header)
+	if len(lines) != 4 || header.Version != ExportVersion {
+		t.Errorf("Expected a header with version %d and 3 executions, got %s", ExportVersion, buf.String())
+	}
+
+	// importing twice replaces the executions
+	to := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+	for ix := 0; ix < 2; ix++ {
+		if result, err := Import(bytes.NewReader(buf.Bytes()), to); err != nil || result.Imported != 3 {
+			t.Fatalf("Imported %d executions, expected 3, error: %v", result.Imported, err)
+		}
+	}
+
+	for _, e := range append(a, b...) {
+		imported, found, _ := to.Get(e.ID)
+		if !found || !reflect.DeepEqual(imported, e) {
+			t.Errorf("Got %+v, expected %+v", imported, e)
+		}
+	}
+	if executions, _ := readExecutions(to, "a"); len(executions) != 2 {
+		t.Errorf("Got %d executions of job a in the index, expected 2", len(executions))
+	}
+
+	buf.Reset()
+	if n, _ := Export(&buf, from, "b"); n != 1 {
+		t.Errorf("Exported %d executions of job b, expected 1", n)
+	}
+}
+
+func TestImportUnfinished(t *testing.T) {
+	from := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+	e := storeExecutions(from, "a", time.Now())[0]
+	e.State = StateRunning
+	e.TaskExecutions[0].State = StateRunning
+	e.TaskExecutions[0].Attempts = []TaskAttempt{{Attempt: 1, State: StateRunning}}
+	persistExecution(from, e)
+
+	var buf bytes.Buffer
+	Export(&buf, from)
+
+	to := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+	result, err := Import(&buf, to)
+	if err != nil || result.Imported != 1 || result.Cancelled != 1 {
+		t.Fatalf("Got %+v with error %v, expected 1 execution imported and cancelled", result, err)
+	}
+
+	imported, _, _ := to.Get(e.ID)
+	task := imported.TaskExecutions[0]
+	if imported.State != StateCancelled || task.State != StateCancelled || task.Attempts[0].State != StateCancelled {
+		t.Errorf("Got %+v, expected the unfinished execution to be cancelled", imported)
+	}
+	if task.Error != errExportedUnfinished {
+		t.Errorf("Got error %q, expected %q", task.Error, errExportedUnfinished)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	header := `{"format":"goflow-executions","version":1}` + "\n"
+	execution := `{"id":"0b4f1b5e-7f53-4d6b-9d0a-5c4a5e8a1f00","job":"a","submitted":"2024-01-01T00:00:00Z","state":"successful"}` + "\n"
+
+	cases := []struct {
+		input    string
+		imported int
+	}{
+		{"", 0},
+		{execution, 0},
+		{`{"format":"goflow-executions","version":2}` + "\n" + execution, 0},
+		{header + execution + "{oops\n", 1},
+		{header + execution + `{"job":"a","submitted":"2024-01-01T00:00:00Z"}`, 1},
+		{header + `{"id":"0b4f1b5e-7f53-4d6b-9d0a-5c4a5e8a1f00","job":"a","submitted":"yesterday"}`, 0},
+	}
+
+	for _, c := range cases {
+		s := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+		result, err := Import(strings.NewReader(c.input), s)
+		if err == nil || result.Imported != c.imported {
+			t.Errorf("Imported %d executions with error %v from %q, expected %d and an error", result.Imported, err, c.input, c.imported)
+		}
+	}
+}
+
+func TestExportImportRoutes(t *testing.T) {
+	newEngine := func() *Goflow {
+		g := New(Options{})
+		g.AddJob(func() *Job {
+			j := &Job{Name: "moved", Schedule: "0 * * * *"}
+			j.Add(&Task{Name: "true", Operator: Command{Cmd: "true"}})
+			return j
+		})
+		g.addAPIRoutes()
+		return g
+	}
+
+	from := newEngine()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	storeExecutions(from.Executions, "moved", start, start.Add(time.Hour))
+	storeExecutions(from.Executions, "unregistered", start)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/executions/export", nil)
+	from.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("httpStatus is %d, expected %d", w.Code, http.StatusOK)
+	}
+
+	to := newEngine()
+	export := w.Body.String()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/executions/import", strings.NewReader(export))
+	to.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"imported":3`) {
+		t.Errorf("httpStatus is %d with %s, expected %d", w.Code, w.Body.String(), http.StatusOK)
+	}
+	if executions, _ := readExecutions(to.Executions, "moved"); len(executions) != 2 {
+		t.Errorf("Got %d imported executions, expected 2", len(executions))
+	}
+	if executions, _ := readExecutions(to.Executions, "unregistered"); len(executions) != 1 {
+		t.Errorf("Got %d imported executions of a job that isn't registered, expected 1", len(executions))
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/executions/import", strings.NewReader("oops"))
+	to.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("httpStatus is %d, expected %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -2,7 +2,13 @@
 package goflow
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -13,21 +19,37 @@ import (
 
 // Goflow contains job data and a router.
 type Goflow struct {
-	Store   gokv.Store
-	Options Options
-	Jobs    map[string](func() *Job)
-	router  *gin.Engine
-	cron    *cron.Cron
-	jobs    []string
+	Store      gokv.Store
+	Executions ExecutionStore
+	Options    Options
+	Jobs       map[string](func() *Job)
+	router     *gin.Engine
+	cron       *cron.Cron
+	parser     cron.Parser
+	jobs       []string
+	server     *http.Server
+	running    map[uuid.UUID]*runningExecution
+	queued     map[string][]queuedExecution
+	seq        int
+	slots      *taskSlots
+	stop       chan struct{}
+	closing    bool
+	wg         sync.WaitGroup
+	mu         sync.Mutex
 }
 
 // Options to control various Goflow behavior.
 type Options struct {
-	Store        gokv.Store
-	UIPath       string
-	Streaming    bool
-	ShowExamples bool
-	WithSeconds  bool
+	Store           gokv.Store
+	Executions      ExecutionStore
+	UIPath          string
+	Streaming       bool
+	ShowExamples    bool
+	WithSeconds     bool
+	Recovery        RecoveryPolicy
+	MaxRunningTasks int
+	Pools           map[string]int
+	Retention       Retention
 }
 
 // New returns a Goflow engine.
@@ -37,26 +59,39 @@ func New(opts Options) *Goflow {
 	if opts.Store == nil {
 		opts.Store = gomap.NewStore(gomap.DefaultOptions)
 	}
+	if opts.Executions == nil {
+		opts.Executions = NewKVStore(opts.Store)
+	}
 
 	// Add the cron schedule
-	var c *cron.Cron
+	var p cron.Parser
 	if opts.WithSeconds {
-		c = cron.New(cron.WithSeconds())
+		p = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
 	} else {
-		c = cron.New()
+		p = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
 	}
+	c := cron.New(cron.WithParser(p))
 
 	g := &Goflow{
-		Store:   opts.Store,
-		Options: opts,
-		Jobs:    make(map[string](func() *Job)),
-		router:  gin.New(),
-		cron:    c,
+		Store:      opts.Store,
+		Executions: opts.Executions,
+		Options:    opts,
+		Jobs:       make(map[string](func() *Job)),
+		router:     gin.New(),
+		cron:       c,
+		parser:     p,
+		running:    make(map[uuid.UUID]*runningExecution),
+		queued:     make(map[string][]queuedExecution),
+		slots:      newTaskSlots(opts.MaxRunningTasks, opts.Pools),
+		stop:       make(chan struct{}),
 	}
 
 	if opts.ShowExamples {
-		g.AddJob(complexAnalyticsJob)
-		g.AddJob(customOperatorJob)
+		for _, fn := range []func() *Job{complexAnalyticsJob, customOperatorJob} {
+			if err := g.AddJob(exampleJob(fn, opts.WithSeconds)); err != nil {
+				log.Printf("job=%v, msg=example not added, error=%v", fn().Name, err)
+			}
+		}
 	}
 
 	return g
@@ -64,51 +99,106 @@ func New(opts Options) *Goflow {
 
 // scheduledExecution implements cron.Job
 type scheduledExecution struct {
-	store   gokv.Store
+	engine  *Goflow
 	jobFunc func() *Job
 }
 
 func (schedExec *scheduledExecution) Run() {
+	g := schedExec.engine
 
 	// create job
 	job := schedExec.jobFunc()
 
-	// create and persist a new execution
-	e := job.newExecution()
-	persistNewExecution(schedExec.store, e)
-	indexExecutions(schedExec.store, e)
+	// scheduled runs use the default params
+	params, err := job.resolveParams(nil)
+	if err != nil {
+		log.Printf("job=%v, msg=not scheduled, error=%v", job.Name, err)
+		return
+	}
 
-	// start running the job
-	job.run(schedExec.store, e)
+	// create a new execution, covering the interval that ends now
+	e := job.newExecution(params)
+	if i, ok := g.jobInterval(job, time.Now()); ok {
+		e.setInterval(i)
+	}
+
+	// start running the job, unless the engine is shutting down
+	if err := g.submit(job, e); err != nil && err != errSkipped {
+		log.Printf("job=%v, msg=not scheduled, error=%v", job.Name, err)
+	}
 }
 
 // AddJob takes a job-emitting function and registers it
-// with the engine.
-func (g *Goflow) AddJob(jobFunc func() *Job) *Goflow {
+// with the engine. It returns an error if the job is invalid,
+// a job with the same name is already registered, or the job
+// can't run with the task limits of the engine.
+func (g *Goflow) AddJob(jobFunc func() *Job) error {
 
 	j := jobFunc()
 
-	// TODO: change the return type here to error
-	// "" is not a valid key in the storage layer
-	//if j.Name == "" {
-	//		return errors.New("\"\" is not a valid job name")
-	//	}
+	if err := j.Validate(); err != nil {
+		return err
+	}
+
+	if _, ok := g.Jobs[j.Name]; ok {
+		return fmt.Errorf("Job %s is already registered", j.Name)
+	}
+
+	// A negative limit would otherwise mean no limit at all
+	if g.Options.MaxRunningTasks < 0 {
+		return fmt.Errorf("Invalid MaxRunningTasks %d, expected 0 or more", g.Options.MaxRunningTasks)
+	}
+
+	// Tasks can only use the pools of the engine, and a pool without
+	// slots would keep its tasks queued forever
+	for _, name := range j.tasks {
+		if pool := j.Tasks[name].Pool; pool != "" {
+			size, ok := g.Options.Pools[pool]
+			if !ok {
+				return fmt.Errorf("Unknown pool %s for task %s in job %s", pool, name, j.Name)
+			}
+			if size < 1 {
+				return fmt.Errorf("Invalid size %d of pool %s for task %s in job %s, expected at least 1", size, pool, name, j.Name)
+			}
+		}
+	}
+
+	// The schedule must also match the engine's cron spec format
+	if j.Schedule != "" {
+		if _, err := g.parser.Parse(j.Schedule); err != nil {
+			return fmt.Errorf("Invalid schedule %q for job %s: %v", j.Schedule, j.Name, err)
+		}
+	}
+
+	// A schedule toggled from the dashboard or API overrides the default
+	active, err := g.loadSchedule(j)
+	if err != nil {
+		return err
+	}
+	if active {
+		if err := j.checkActivation(); err != nil {
+			return err
+		}
+	}
+
+	// Executions stored by earlier versions are moved to the new index
+	if err := migrateIndex(g.Store, g.Executions, j.Name); err != nil {
+		return err
+	}
 
 	// Register the job
 	g.Jobs[j.Name] = jobFunc
 	g.jobs = append(g.jobs, j.Name)
 
-	// If the job is active by default, add it to the cron schedule
-	if j.Active {
-		e := &scheduledExecution{g.Store, jobFunc}
-		_, err := g.cron.AddJob(j.Schedule, e)
-
-		if err != nil {
-			panic(err)
+	// If the job is active, add it to the cron schedule
+	if active {
+		e := &scheduledExecution{g, jobFunc}
+		if _, err := g.cron.AddJob(j.Schedule, e); err != nil {
+			return err
 		}
 	}
 
-	return g
+	return nil
 }
 
 // toggle flips a job's cron schedule status from active to inactive
@@ -120,32 +210,241 @@ func (g *Goflow) toggle(jobName string) (bool, error) {
 	for _, entry := range g.cron.Entries() {
 		if name := entry.Job.(*scheduledExecution).jobFunc().Name; name == jobName {
 			g.cron.Remove(entry.ID)
-			return false, nil
+			return false, g.persistSchedule(jobName, false)
 		}
 	}
 
 	// else add a new entry
 	jobFunc := g.Jobs[jobName]
-	e := &scheduledExecution{g.Store, jobFunc}
-	g.cron.AddJob(jobFunc().Schedule, e)
-	return true, nil
+	if err := jobFunc().checkActivation(); err != nil {
+		return false, err
+	}
+	e := &scheduledExecution{g, jobFunc}
+	if _, err := g.cron.AddJob(jobFunc().Schedule, e); err != nil {
+		return false, err
+	}
+	return true, g.persistSchedule(jobName, true)
 }
 
-// execute tells the engine to run a given job in a new goroutine.
-func (g *Goflow) execute(job string) uuid.UUID {
+// isActive returns true if the job's cron schedule is active.
+func (g *Goflow) isActive(jobName string) bool {
+	for _, entry := range g.cron.Entries() {
+		if name := entry.Job.(*scheduledExecution).jobFunc().Name; name == jobName {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleState is the persisted status of a job's cron schedule.
+type scheduleState struct {
+	Active bool `json:"active"`
+}
+
+func scheduleKey(jobName string) string {
+	return "goflow:schedule:" + jobName
+}
+
+// loadSchedule returns whether a job's schedule is active. The status
+// persisted by toggle takes precedence over the job's Active field.
+func (g *Goflow) loadSchedule(j *Job) (bool, error) {
+	st := scheduleState{}
+	found, err := g.Store.Get(scheduleKey(j.Name), &st)
+	if err != nil {
+		return false, fmt.Errorf("Failed to read the schedule of job %s: %v", j.Name, err)
+	}
+	if !found {
+		return j.Active, nil
+	}
+	return st.Active, nil
+}
+
+// persistSchedule saves the status of a job's cron schedule, so that it
+// survives a restart.
+func (g *Goflow) persistSchedule(jobName string, active bool) error {
+	return g.Store.Set(scheduleKey(jobName), scheduleState{active})
+}
+
+// execute tells the engine to run a given job in a new goroutine, with
+// the given runtime params. The job's MaxActiveRuns and overlap policy
+// apply.
+func (g *Goflow) execute(job string, params map[string]interface{}) (uuid.UUID, error) {
 
 	// create job
 	j := g.Jobs[job]()
 
-	// create and persist a new execution
-	e := j.newExecution()
-	persistNewExecution(g.Store, e)
-	indexExecutions(g.Store, e)
+	params, err := j.resolveParams(params)
+	if err != nil {
+		return uuid.Nil, err
+	}
 
-	// start running the job
-	go j.run(g.Store, e)
+	// create a new execution. A job with a schedule covers the last
+	// complete interval.
+	e := j.newExecution(params)
+	if i, ok := g.jobInterval(j, time.Now()); ok {
+		e.setInterval(i)
+	}
 
-	return e.ID
+	// start running the job, unless the engine is shutting down. A
+	// skipped execution is still recorded.
+	switch err := g.submit(j, e); err {
+	case nil, errSkipped:
+		return e.ID, err
+	default:
+		return uuid.Nil, err
+	}
+}
+
+var (
+	errShuttingDown = errors.New("Goflow is shutting down")
+	errRunning      = errors.New("Execution is still running")
+	errUnknownJob   = errors.New("Job is not registered")
+)
+
+// retry runs the failed, skipped and cancelled tasks of a finished
+// execution again, along with everything downstream of them.
+func (g *Goflow) retry(e *Execution) error {
+	tasks := make([]string, 0)
+	for _, task := range e.TaskExecutions {
+		if task.State == StateFailed || task.State == StateSkipped || task.State == StateCancelled {
+			tasks = append(tasks, task.Name)
+		}
+	}
+	return g.rerun(e, tasks)
+}
+
+// mark sets the state of a task in a finished execution, for example to
+// let downstream tasks run after the data was fixed by hand.
+func (g *Goflow) mark(e *Execution, taskName string, value State) error {
+	if !e.State.finished() {
+		return errRunning
+	}
+	if !(value == StateSuccessful || value == StateFailed || value == StateSkipped) {
+		return fmt.Errorf("Tasks can't be marked %s", value)
+	}
+
+	jobFunc, ok := g.Jobs[e.JobName]
+	if !ok {
+		return errUnknownJob
+	}
+	j := jobFunc()
+
+	for ix, task := range e.TaskExecutions {
+		if task.Name == taskName {
+			e.TaskExecutions[ix].State = value
+			e.TaskExecutions[ix].Error = ""
+		}
+	}
+	j.restore(e)
+
+	log.Printf("jobID=%v, job=%v, task=%v, msg=marked %v", e.ID, e.JobName, taskName, value)
+	if err := persistExecution(g.Executions, e); err != nil {
+		return storeError{err}
+	}
+	return nil
+}
+
+// rerun resets the given tasks of a finished execution, and everything
+// downstream of them, then continues running the execution in a new
+// goroutine. The execution keeps its ID and the history of its task
+// attempts.
+func (g *Goflow) rerun(e *Execution, tasks []string) error {
+	if !e.State.finished() {
+		return errRunning
+	}
+
+	jobFunc, ok := g.Jobs[e.JobName]
+	if !ok {
+		return errUnknownJob
+	}
+	j := jobFunc()
+
+	reset := make(map[string]bool)
+	for _, task := range tasks {
+		reset[task] = true
+		for _, ds := range j.Dag.descendants(task) {
+			reset[ds] = true
+		}
+	}
+
+	for ix, task := range e.TaskExecutions {
+		if reset[task.Name] {
+			e.TaskExecutions[ix].State = StateNotStarted
+			e.TaskExecutions[ix].Error = ""
+			e.TaskExecutions[ix].Result = nil
+		}
+	}
+	j.restore(e)
+
+	// the reset tasks are only persisted once the rerun is admitted, so a
+	// rerun that is skipped leaves the stored execution as it was
+	return g.start(j, e, nil, func() {
+		log.Printf("jobID=%v, job=%v, msg=rerunning", e.ID, e.JobName)
+		if err := persistExecution(g.Executions, e); err != nil {
+			log.Printf("jobID=%v, job=%v, error=%v", e.ID, e.JobName, err)
+		}
+	})
+}
+
+// trackLocked registers an execution so that it can be cancelled, and so
+// that Shutdown waits for it. It returns the context to run the execution
+// with. It must be called with g.mu held.
+func (g *Goflow) trackLocked(e *Execution, done func()) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	g.seq++
+	g.running[e.ID] = &runningExecution{jobName: e.JobName, cancel: cancel, seq: g.seq, done: done}
+	g.wg.Add(1)
+	return ctx
+}
+
+// runExecution runs a tracked execution of a job and stops tracking it
+// once it finishes. The next queued execution of the job is then started.
+func (g *Goflow) runExecution(ctx context.Context, j *Job, e *Execution) error {
+	defer func() {
+		g.mu.Lock()
+		r := g.running[e.ID]
+		r.cancel()
+		delete(g.running, e.ID)
+		next := g.dequeue(e.JobName)
+		g.mu.Unlock()
+		g.wg.Done()
+
+		if r.done != nil {
+			r.done()
+		}
+
+		if next != nil {
+			go g.runExecution(next.ctx, next.job, next.e)
+		}
+	}()
+
+	j.slots = g.slots
+	return j.run(ctx, g.Executions, e)
+}
+
+// cancel signals a running execution to stop, or removes a queued
+// execution from the queue. It returns false if the execution is neither
+// running nor queued.
+func (g *Goflow) cancel(id uuid.UUID) bool {
+	g.mu.Lock()
+	r, ok := g.running[id]
+	if ok {
+		r.cancel()
+	}
+	g.mu.Unlock()
+	if ok {
+		return true
+	}
+
+	q, ok := g.unqueue(id)
+	if ok {
+		log.Printf("jobID=%v, job=%v, msg=cancelled", q.e.ID, q.e.JobName)
+		finishUnstarted(g, q.e, StateCancelled, errCancelled.Error())
+		if q.done != nil {
+			q.done()
+		}
+	}
+	return ok
 }
 
 // Use middleware in the Gin router.
@@ -154,8 +453,9 @@ func (g *Goflow) Use(middleware gin.HandlerFunc) *Goflow {
 	return g
 }
 
-// Run runs the webserver.
-func (g *Goflow) Run(port string) {
+// Run starts the cron scheduler and runs the webserver. It blocks until
+// the webserver stops, and returns nil if it was stopped by Shutdown.
+func (g *Goflow) Run(port string) error {
 	log.SetFlags(0)
 	log.SetOutput(new(logWriter))
 	g.router.Use(gin.Recovery())
@@ -165,6 +465,79 @@ func (g *Goflow) Run(port string) {
 		g.addUIRoutes()
 		g.addStaticRoutes()
 	}
+
+	g.mu.Lock()
+	if g.closing {
+		g.mu.Unlock()
+		return errShuttingDown
+	}
+	g.server = &http.Server{Addr: port, Handler: g.router}
+	g.mu.Unlock()
+
+	g.recoverExecutions()
+	g.catchUp()
+	g.prune()
+	go g.pruneLoop()
 	g.cron.Start()
-	g.router.Run(port)
+
+	log.Printf("msg=listening on %v", port)
+	if err := g.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown gracefully stops the engine. It stops the cron scheduler and
+// rejects new submissions, then waits for the running executions to
+// finish. If ctx is done first, the running executions are cancelled and
+// Shutdown waits for their final state to be persisted. Finally the
+// webserver is closed. Shutdown returns the context error if the running
+// executions had to be cancelled.
+func (g *Goflow) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	if !g.closing {
+		close(g.stop)
+	}
+	g.closing = true
+	server := g.server
+	g.mu.Unlock()
+
+	log.Printf("msg=shutting down")
+	g.cron.Stop()
+
+	finished := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(finished)
+	}()
+
+	var err error
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		log.Printf("msg=cancelling running executions")
+		g.mu.Lock()
+		for _, r := range g.running {
+			r.cancel()
+		}
+		g.mu.Unlock()
+		<-finished
+		err = ctx.Err()
+	}
+
+	if server == nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		server.Close()
+		return err
+	}
+	return server.Shutdown(ctx)
+}
+
+// isClosing returns true once Shutdown has been called.
+func (g *Goflow) isClosing() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.closing
 }
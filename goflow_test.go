@@ -1,11 +1,17 @@
 package goflow
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/philippgille/gokv/gomap"
 )
 
@@ -91,6 +97,54 @@ func TestExecutionsRoute(t *testing.T) {
 	}
 }
 
+func TestExecutionsRoutePaging(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(func() *Job {
+		j := &Job{Name: "paged", Schedule: "0 * * * *"}
+		j.Add(&Task{Name: "true", Operator: Command{Cmd: "true"}})
+		return j
+	})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	storeExecutions(g.Executions, "paged", start, start.Add(time.Hour), start.Add(2*time.Hour))
+	g.addAPIRoutes()
+	r := g.router
+
+	type page struct {
+		Executions []*Execution `json:"executions"`
+		Next       string       `json:"next"`
+	}
+
+	seen := 0
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/executions?jobname=paged&limit=2&cursor="+cursor, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("httpStatus is %d, expected %d", w.Code, http.StatusOK)
+		}
+		p := page{}
+		json.Unmarshal(w.Body.Bytes(), &p)
+		seen += len(p.Executions)
+		if p.Next == "" {
+			break
+		}
+		cursor = p.Next
+	}
+	if seen != 3 {
+		t.Errorf("Got %d executions, expected 3", seen)
+	}
+
+	for _, query := range []string{"limit=0", "limit=1001", "cursor=oops", "since=yesterday"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/executions?"+query, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("httpStatus is %d for %s, expected %d", w.Code, query, http.StatusBadRequest)
+		}
+	}
+}
+
 func TestJobSubmitToRouter(t *testing.T) {
 	var w = httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/api/jobs/example-complex-analytics/submit", nil)
@@ -118,6 +172,102 @@ func TestJobSubmitToRouter(t *testing.T) {
 	}
 }
 
+func TestJobSubmitWithParams(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(paramsJob)
+	g.addAPIRoutes()
+
+	var w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/jobs/params/submit", strings.NewReader(`{"limit": 5}`))
+	g.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("httpStatus is %d, expected %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/jobs/params/submit", strings.NewReader(`{"date": "2024-01-01"}`))
+	g.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("httpStatus is %d, expected %d", w.Code, http.StatusOK)
+	}
+
+	var msg struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &msg)
+	g.wg.Wait()
+
+	e, _, _ := g.Executions.Get(uuid.MustParse(msg.ID))
+	if e.Params["date"] != "2024-01-01" || e.Params["limit"] != float64(10) {
+		t.Errorf("Got params %v", e.Params)
+	}
+	if out := e.TaskExecutions[0].Attempts[0].Stdout; out != "2024-01-01 10\n" {
+		t.Errorf("Got output %q", out)
+	}
+}
+
+func TestBackfillRoute(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(func() *Job {
+		j := &Job{Name: "hourly", Schedule: "0 * * * *"}
+		j.Add(&Task{Name: "echo", Templated: true, Operator: Command{Cmd: "echo", Args: []string{"-n", "{{.IntervalStart.Format \"15:04\"}}"}}})
+		return j
+	})
+	g.AddJob(sleepJob("0"))
+	g.addAPIRoutes()
+
+	backfill := func(job, query string) (int, []string) {
+		var msg struct {
+			Executions []string `json:"executions"`
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/jobs/"+job+"/backfill?"+query, nil)
+		g.router.ServeHTTP(w, req)
+		json.Unmarshal(w.Body.Bytes(), &msg)
+		return w.Code, msg.Executions
+	}
+
+	code, ids := backfill("hourly", "start=2024-01-01T00:00:00Z&end=2024-01-01T03:00:00Z&concurrency=2")
+	if code != http.StatusOK || len(ids) != 3 {
+		t.Fatalf("Got httpStatus %d and %d executions, expected %d and 3", code, len(ids), http.StatusOK)
+	}
+
+	for ix, id := range ids {
+		var e *Execution
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			if e, _, _ = g.Executions.Get(uuid.MustParse(id)); e.State.finished() {
+				break
+			}
+		}
+		expected := time.Date(2024, 1, 1, ix, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		if e.IntervalStart != expected {
+			t.Errorf("Got interval start %v, expected %v", e.IntervalStart, expected)
+		}
+		if e.State != StateSuccessful || e.TaskExecutions[0].Result != expected[11:16] {
+			t.Errorf("Got status %v and result %v", e.State, e.TaskExecutions[0].Result)
+		}
+	}
+	g.wg.Wait()
+
+	// intervals that already have an execution are skipped
+	code, ids = backfill("hourly", "start=2024-01-01T00:00:00Z&end=2024-01-01T04:00:00Z")
+	if code != http.StatusOK || len(ids) != 1 {
+		t.Errorf("Got httpStatus %d and %d executions, expected %d and 1", code, len(ids), http.StatusOK)
+	}
+
+	for _, query := range []string{"start=2024-01-01&end=2024-01-02T00:00:00Z", "start=2024-01-02T00:00:00Z&end=2024-01-01T00:00:00Z", "start=2024-01-01T00:00:00Z&end=2024-01-01T03:00:00Z&concurrency=0", "start=2000-01-01T00:00:00Z&end=2024-01-01T00:00:00Z"} {
+		if code, _ := backfill("hourly", query); code != http.StatusBadRequest {
+			t.Errorf("httpStatus is %d for %s, expected %d", code, query, http.StatusBadRequest)
+		}
+	}
+
+	if code, _ := backfill("nope", "start=2024-01-01T00:00:00Z&end=2024-01-01T03:00:00Z"); code != http.StatusNotFound {
+		t.Errorf("httpStatus is %d, expected %d", code, http.StatusNotFound)
+	}
+}
+
 func TestJobToggleActiveRoute(t *testing.T) {
 	var w = httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/api/jobs/example-complex-analytics/toggle", nil)
@@ -203,6 +353,32 @@ func TestStreamRoute(t *testing.T) {
 	}
 }
 
+func TestStreamEachJob(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(twoStepJob)
+	g.AddJob(func() *Job {
+		j := &Job{Name: "quiet"}
+		j.Add(&Task{Name: "only", Operator: Command{Cmd: "true"}})
+		return j
+	})
+	g.addStreamRoute(false)
+
+	// a busy job doesn't push the other jobs out of the stream
+	quiet := g.Jobs["quiet"]().newExecution(nil)
+	saveNewExecution(g.Executions, quiet)
+	for i := 0; i <= streamSize; i++ {
+		saveNewExecution(g.Executions, twoStepJob().newExecution(nil))
+	}
+
+	w := CreateTestResponseRecorder()
+	req, _ := http.NewRequest("GET", "/stream", nil)
+	g.router.ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), quiet.ID.String()) {
+		t.Errorf("Expected the execution of the quiet job in the stream")
+	}
+}
+
 // check for a race against /stream
 func TestToggleRaceCondition(t *testing.T) {
 	var w = httptest.NewRecorder()
@@ -210,9 +386,106 @@ func TestToggleRaceCondition(t *testing.T) {
 	router.ServeHTTP(w, req)
 }
 
+func TestCancelExecutionRoute(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(func() *Job {
+		j := &Job{Name: "sleepy", Schedule: "* * * * *"}
+		j.Add(&Task{Name: "sleep-ten", Operator: Command{Cmd: "sleep", Args: []string{"10"}}})
+		return j
+	})
+	g.addAPIRoutes()
+
+	id, _ := g.execute("sleepy", nil)
+
+	// wait for the execution to register
+	for {
+		g.mu.Lock()
+		_, ok := g.running[id]
+		g.mu.Unlock()
+		if ok {
+			break
+		}
+	}
+
+	var w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/executions/"+id.String()+"/cancel", nil)
+	g.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("httpStatus is %d, expected %d", w.Code, http.StatusOK)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/executions/"+uuid.New().String()+"/cancel", nil)
+	g.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("httpStatus is %d, expected %d", w.Code, http.StatusNotFound)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/executions/bla/cancel", nil)
+	g.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("httpStatus is %d, expected %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestTaskLogsRoute(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(func() *Job {
+		j := &Job{Name: "echo", Schedule: "* * * * *"}
+		j.Add(&Task{Name: "echo-hello", Operator: Command{Cmd: "echo", Args: []string{"hello"}}})
+		return j
+	})
+	g.addAPIRoutes()
+
+	j := g.Jobs["echo"]()
+	e := j.newExecution(nil)
+	saveNewExecution(g.Executions, e)
+	j.run(context.Background(), g.Executions, e)
+
+	var w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/executions/"+e.ID.String()+"/tasks/echo-hello/logs", nil)
+	g.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("httpStatus is %d, expected %d", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), `"stdout":"hello\n"`) {
+		t.Errorf("Got body %s, expected the stdout of the task", w.Body.String())
+	}
+
+	// the logs are left out of the list of executions
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/executions?jobname=echo", nil)
+	g.router.ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), e.ID.String()) || strings.Contains(w.Body.String(), "stdout") {
+		t.Errorf("Got body %s, expected the execution without its logs", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/executions/"+e.ID.String()+"/tasks/bla/logs", nil)
+	g.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("httpStatus is %d, expected %d", w.Code, http.StatusNotFound)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/executions/"+uuid.New().String()+"/tasks/echo-hello/logs", nil)
+	g.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("httpStatus is %d, expected %d", w.Code, http.StatusNotFound)
+	}
+}
+
 func exampleRouter() *gin.Engine {
 	g := New(Options{UIPath: "ui/", ShowExamples: true, WithSeconds: true})
-	g.execute("example-custom-operator")
+	g.execute("example-custom-operator", nil)
 	g.Use(DefaultLogger())
 	g.addStaticRoutes()
 	g.addStreamRoute(false)
@@ -223,10 +496,261 @@ func exampleRouter() *gin.Engine {
 
 func TestScheduledExecution(t *testing.T) {
 	store := gomap.NewStore(gomap.DefaultOptions)
-	schedExec := scheduledExecution{store, customOperatorJob}
+	schedExec := scheduledExecution{New(Options{Store: store}), customOperatorJob}
 	schedExec.Run()
 }
 
+func TestAddJob(t *testing.T) {
+	g := New(Options{WithSeconds: true})
+
+	if err := g.AddJob(customOperatorJob); err != nil {
+		t.Errorf("Got error %v", err)
+	}
+
+	if err := g.AddJob(customOperatorJob); err == nil {
+		t.Errorf("Expected an error for a duplicate job")
+	}
+
+	if err := g.AddJob(func() *Job { return &Job{Name: ""} }); err == nil {
+		t.Errorf("Expected an error for an empty job name")
+	}
+
+	// the engine expects cron specs with seconds
+	if err := g.AddJob(func() *Job { return &Job{Name: "no-seconds", Schedule: "* * * * *"} }); err == nil {
+		t.Errorf("Expected an error for an invalid schedule")
+	}
+}
+
+func isScheduled(g *Goflow, jobName string) bool {
+	for _, entry := range g.cron.Entries() {
+		if entry.Job.(*scheduledExecution).jobFunc().Name == jobName {
+			return true
+		}
+	}
+	return false
+}
+
+func TestToggleIsPersisted(t *testing.T) {
+	store := gomap.NewStore(gomap.DefaultOptions)
+
+	g := New(Options{Store: store, WithSeconds: true})
+	g.AddJob(customOperatorJob)
+
+	if !isScheduled(g, "example-custom-operator") {
+		t.Fatalf("Expected the job to be scheduled")
+	}
+	if active, _ := g.toggle("example-custom-operator"); active {
+		t.Errorf("Expected the job to be paused")
+	}
+
+	// a new engine with the same store keeps the job paused
+	g = New(Options{Store: store, WithSeconds: true})
+	g.AddJob(customOperatorJob)
+
+	if isScheduled(g, "example-custom-operator") {
+		t.Errorf("Expected the job to stay paused")
+	}
+}
+
+func TestRetryExecutionRoute(t *testing.T) {
+	flag := t.TempDir() + "/flag"
+
+	g := New(Options{})
+	g.AddJob(func() *Job {
+		j := &Job{Name: "flaky", Schedule: "* * * * *"}
+		j.Add(&Task{Name: "first", Operator: Command{Cmd: "true"}})
+		j.Add(&Task{Name: "check-flag", Operator: Command{Cmd: "test", Args: []string{"-f", flag}}})
+		j.Add(&Task{Name: "last", Operator: Command{Cmd: "true"}})
+		j.SetDownstream(j.Task("first"), j.Task("check-flag"))
+		j.SetDownstream(j.Task("check-flag"), j.Task("last"))
+		return j
+	})
+	g.addAPIRoutes()
+
+	id, _ := g.execute("flaky", nil)
+	g.wg.Wait()
+
+	e, _, _ := g.Executions.Get(id)
+	if e.State != StateFailed {
+		t.Fatalf("Got status %v, expected %v", e.State, StateFailed)
+	}
+
+	os.WriteFile(flag, nil, 0600)
+
+	var w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/executions/"+id.String()+"/retry", nil)
+	g.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("httpStatus is %d, expected %d", w.Code, http.StatusOK)
+	}
+
+	g.wg.Wait()
+
+	e, _, _ = g.Executions.Get(id)
+	if e.State != StateSuccessful {
+		t.Errorf("Got status %v, expected %v", e.State, StateSuccessful)
+	}
+	for _, task := range e.TaskExecutions {
+		if task.Name == "first" && len(task.Attempts) != 1 {
+			t.Errorf("Expected the successful task not to run again")
+		}
+		if task.Name == "check-flag" && len(task.Attempts) != 2 {
+			t.Errorf("Expected the failed task to run again")
+		}
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/executions/"+uuid.New().String()+"/retry", nil)
+	g.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("httpStatus is %d, expected %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestMarkAndClearTaskRoutes(t *testing.T) {
+	flag := t.TempDir() + "/flag"
+
+	g := New(Options{})
+	g.AddJob(func() *Job {
+		j := &Job{Name: "flaky", Schedule: "* * * * *"}
+		j.Add(&Task{Name: "check-flag", Operator: Command{Cmd: "test", Args: []string{"-f", flag}}})
+		j.Add(&Task{Name: "last", Operator: Command{Cmd: "true"}})
+		j.SetDownstream(j.Task("check-flag"), j.Task("last"))
+		return j
+	})
+	g.addAPIRoutes()
+
+	id, _ := g.execute("flaky", nil)
+	g.wg.Wait()
+
+	post := func(path, body string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/executions/"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		g.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post(id.String()+"/tasks/check-flag/mark", `{"state":"running"}`); code != http.StatusBadRequest {
+		t.Errorf("httpStatus is %d, expected %d", code, http.StatusBadRequest)
+	}
+	if code := post(id.String()+"/tasks/unknown/mark", `{"state":"successful"}`); code != http.StatusNotFound {
+		t.Errorf("httpStatus is %d, expected %d", code, http.StatusNotFound)
+	}
+	if code := post(id.String()+"/tasks/check-flag/mark", `{"state":"successful"}`); code != http.StatusOK {
+		t.Errorf("httpStatus is %d, expected %d", code, http.StatusOK)
+	}
+
+	e, _, _ := g.Executions.Get(id)
+	for _, task := range e.TaskExecutions {
+		if task.Name == "check-flag" && task.State != StateSuccessful {
+			t.Errorf("Got status %v, expected %v", task.State, StateSuccessful)
+		}
+	}
+
+	// Clearing the marked task runs it again, along with its downstream task
+	os.WriteFile(flag, nil, 0600)
+	if code := post(id.String()+"/tasks/check-flag/clear", ""); code != http.StatusOK {
+		t.Errorf("httpStatus is %d, expected %d", code, http.StatusOK)
+	}
+	g.wg.Wait()
+
+	e, _, _ = g.Executions.Get(id)
+	if e.State != StateSuccessful {
+		t.Errorf("Got status %v, expected %v", e.State, StateSuccessful)
+	}
+	for _, task := range e.TaskExecutions {
+		if task.Name == "check-flag" && len(task.Attempts) != 2 {
+			t.Errorf("Expected the cleared task to run again")
+		}
+		if task.Name == "last" && len(task.Attempts) != 1 {
+			t.Errorf("Expected the downstream task to run")
+		}
+	}
+
+	if code := post(uuid.New().String()+"/tasks/check-flag/clear", ""); code != http.StatusNotFound {
+		t.Errorf("httpStatus is %d, expected %d", code, http.StatusNotFound)
+	}
+}
+
+func sleepJob(seconds string) func() *Job {
+	return func() *Job {
+		j := &Job{Name: "sleep-" + seconds, Schedule: "* * * * *"}
+		j.Add(&Task{Name: "sleep", Operator: Command{Cmd: "sleep", Args: []string{seconds}}})
+		return j
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(sleepJob("1"))
+
+	stopped := make(chan error)
+	go func() { stopped <- g.Run(":0") }()
+
+	// wait for the webserver to start
+	for {
+		g.mu.Lock()
+		started := g.server != nil
+		g.mu.Unlock()
+		if started {
+			break
+		}
+	}
+
+	id, _ := g.execute("sleep-1", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := g.Shutdown(ctx); err != nil {
+		t.Errorf("Got error %v", err)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Got error %v", err)
+	}
+
+	e, _, _ := g.Executions.Get(id)
+	if e.State != StateSuccessful {
+		t.Errorf("Got status %v, expected %v", e.State, StateSuccessful)
+	}
+
+	if _, err := g.execute("sleep-1", nil); err == nil {
+		t.Errorf("Expected an error when submitting after shutdown")
+	}
+}
+
+func TestShutdownCancelsExecutions(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(sleepJob("10"))
+
+	id, _ := g.execute("sleep-10", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := g.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Got error %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	e, _, _ := g.Executions.Get(id)
+	if e.State != StateCancelled {
+		t.Errorf("Got status %v, expected %v", e.State, StateCancelled)
+	}
+}
+
+func TestExamplesWithoutSeconds(t *testing.T) {
+	g := New(Options{ShowExamples: true})
+
+	for _, name := range []string{"example-complex-analytics", "example-custom-operator"} {
+		if _, ok := g.Jobs[name]; !ok {
+			t.Errorf("Expected the example job %s", name)
+		}
+	}
+}
+
 func TestGoflowWithoutOptions(t *testing.T) {
 	g := New(Options{})
 	g.Use(DefaultLogger())
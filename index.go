@@ -0,0 +1,330 @@
+package goflow
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/philippgille/gokv"
+)
+
+// The KVStore indexes the executions of each job in hourly buckets, so that
+// the most recent executions can be listed without reading the whole
+// history.
+const bucketLayout = "2006-01-02T15"
+
+// An indexEntry points to an execution from its bucket.
+type indexEntry struct {
+	ID        string `json:"id"`
+	Submitted string `json:"submitted"`
+}
+
+// time returns the submission time of the execution.
+func (i indexEntry) time() time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, i.Submitted)
+	return t
+}
+
+// before orders entries by submission time, then by ID.
+func (i indexEntry) before(other indexEntry) bool {
+	t, o := i.time(), other.time()
+	if t.Equal(o) {
+		return i.ID < other.ID
+	}
+	return t.Before(o)
+}
+
+type executionIndex struct {
+	Entries []indexEntry `json:"entries"`
+}
+
+type jobBuckets struct {
+	Buckets []string `json:"buckets"`
+}
+
+type jobList struct {
+	Jobs []string `json:"jobs"`
+}
+
+const jobsKey = "goflow:jobs"
+
+func bucketsKey(jobName string) string {
+	return "goflow:buckets:" + jobName
+}
+
+func bucketKey(jobName, bucket string) string {
+	return "goflow:index:" + jobName + ":" + bucket
+}
+
+// bucketOf returns the bucket of a submission time.
+func bucketOf(t time.Time) string {
+	return t.UTC().Format(bucketLayout)
+}
+
+// index adds an execution to the index of its job. The index of the job is
+// locked while it is updated, so that concurrent submissions don't drop
+// each other's executions.
+func (s *KVStore) index(e *Execution) error {
+	unlock, err := lockIndex(s.store, jobLock(e.JobName))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return s.addToIndex(e)
+}
+
+// addToIndex adds an execution to the index of its job, unless it is
+// already there. It must be called with the index of the job locked.
+func (s *KVStore) addToIndex(e *Execution) error {
+	entry := indexEntry{ID: e.ID.String(), Submitted: e.StartedAt}
+	bucket := bucketOf(entry.time())
+
+	// add the bucket to the job's list of buckets
+	b := jobBuckets{}
+	if _, err := s.store.Get(bucketsKey(e.JobName), &b); err != nil {
+		return err
+	}
+	if len(b.Buckets) == 0 {
+		if err := s.addJob(e.JobName); err != nil {
+			return err
+		}
+	}
+	ix := sort.SearchStrings(b.Buckets, bucket)
+	if ix == len(b.Buckets) || b.Buckets[ix] != bucket {
+		b.Buckets = append(b.Buckets, "")
+		copy(b.Buckets[ix+1:], b.Buckets[ix:])
+		b.Buckets[ix] = bucket
+		if err := s.store.Set(bucketsKey(e.JobName), b); err != nil {
+			return err
+		}
+	}
+
+	// add the execution to the bucket
+	i := executionIndex{}
+	if _, err := s.store.Get(bucketKey(e.JobName, bucket), &i); err != nil {
+		return err
+	}
+	for _, existing := range i.Entries {
+		if existing.ID == entry.ID {
+			return nil
+		}
+	}
+	i.Entries = append(i.Entries, entry)
+	return s.store.Set(bucketKey(e.JobName, bucket), i)
+}
+
+// addJob adds a job to the list of jobs that have executions.
+func (s *KVStore) addJob(jobName string) error {
+	unlock, err := lockIndex(s.store, jobsLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	l := jobList{}
+	if _, err := s.store.Get(jobsKey, &l); err != nil {
+		return err
+	}
+	if contains(l.Jobs, jobName) {
+		return nil
+	}
+	l.Jobs = append(l.Jobs, jobName)
+	return s.store.Set(jobsKey, l)
+}
+
+// unindex removes an execution from the index of its job, and deletes its
+// bucket if it was the last execution in it.
+func (s *KVStore) unindex(e *Execution) error {
+	unlock, err := lockIndex(s.store, jobLock(e.JobName))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	t, _ := time.Parse(time.RFC3339Nano, e.StartedAt)
+	bucket := bucketOf(t)
+
+	entries, err := s.readBucket(e.JobName, bucket)
+	if err != nil {
+		return err
+	}
+	keep := make([]indexEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.ID != e.ID.String() {
+			keep = append(keep, entry)
+		}
+	}
+
+	switch {
+	case len(keep) == len(entries):
+		return nil
+	case len(keep) > 0:
+		return s.store.Set(bucketKey(e.JobName, bucket), executionIndex{keep})
+	}
+
+	if err := s.store.Delete(bucketKey(e.JobName, bucket)); err != nil {
+		return err
+	}
+	buckets, err := s.readBuckets(e.JobName)
+	if err != nil {
+		return err
+	}
+	remaining := make([]string, 0, len(buckets))
+	for _, b := range buckets {
+		if b != bucket {
+			remaining = append(remaining, b)
+		}
+	}
+	return s.store.Set(bucketsKey(e.JobName), jobBuckets{remaining})
+}
+
+// readJobs returns the jobs that have executions.
+func (s *KVStore) readJobs() ([]string, error) {
+	l := jobList{}
+	_, err := s.store.Get(jobsKey, &l)
+	return l.Jobs, err
+}
+
+// readBuckets returns the buckets of a job, oldest first.
+func (s *KVStore) readBuckets(jobName string) ([]string, error) {
+	b := jobBuckets{}
+	_, err := s.store.Get(bucketsKey(jobName), &b)
+	return b.Buckets, err
+}
+
+// readBucket returns the index entries of a bucket, oldest first.
+func (s *KVStore) readBucket(jobName, bucket string) ([]indexEntry, error) {
+	i := executionIndex{}
+	if _, err := s.store.Get(bucketKey(jobName, bucket), &i); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(i.Entries, func(a, b int) bool { return i.Entries[a].before(i.Entries[b]) })
+	return i.Entries, nil
+}
+
+// bounds are the limits of a query on the index.
+type bounds struct {
+	since  time.Time
+	until  time.Time
+	cursor *indexEntry
+}
+
+// matches returns true if the entry is within the bounds.
+func (b bounds) matches(entry indexEntry) bool {
+	t := entry.time()
+	if !b.since.IsZero() && t.Before(b.since) {
+		return false
+	}
+	if !b.until.IsZero() && !t.Before(b.until) {
+		return false
+	}
+	return b.cursor == nil || entry.before(*b.cursor)
+}
+
+// skipBucket returns true if no entry of the bucket can be within the
+// bounds.
+func (b bounds) skipBucket(bucket string) bool {
+	start, err := time.Parse(bucketLayout, bucket)
+	if err != nil {
+		return false
+	}
+	end := start.Add(time.Hour)
+	if !b.since.IsZero() && !end.After(b.since) {
+		return true
+	}
+	if !b.until.IsZero() && !start.Before(b.until) {
+		return true
+	}
+	return b.cursor != nil && b.cursor.time().Before(start)
+}
+
+// encodeCursor returns an opaque cursor pointing after an entry.
+func encodeCursor(entry *indexEntry) string {
+	if entry == nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(entry.Submitted + "|" + entry.ID))
+}
+
+// decodeCursor reads a cursor returned by encodeCursor.
+func decodeCursor(cursor string) (*indexEntry, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(b), "|", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	if _, err := time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if _, err := uuid.Parse(parts[1]); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &indexEntry{ID: parts[1], Submitted: parts[0]}, nil
+}
+
+// legacyIndex is the index of earlier versions, which kept all the
+// executions of a job in one list under the job name, and each execution
+// under its bare ID.
+type legacyIndex struct {
+	ExecutionIDs []string `json:"executions"`
+}
+
+// valid returns false if the value read under a job name is not a legacy
+// index, but some other record.
+func (l legacyIndex) valid() bool {
+	if len(l.ExecutionIDs) == 0 {
+		return false
+	}
+	for _, id := range l.ExecutionIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// migrateIndex moves the executions of a job from the legacy index of a
+// gokv.Store to an ExecutionStore. It is called before the job is
+// registered, so nothing else updates its executions meanwhile. Job names
+// in the goflow namespace, and keys that don't hold a legacy index, are
+// left alone.
+func migrateIndex(from gokv.Store, to ExecutionStore, jobName string) error {
+	if strings.HasPrefix(jobName, "goflow:") {
+		return nil
+	}
+
+	legacy := legacyIndex{}
+	found, err := from.Get(jobName, &legacy)
+	if err != nil || !found || !legacy.valid() {
+		return err
+	}
+
+	for _, id := range legacy.ExecutionIDs {
+		e := Execution{}
+		found, err := from.Get(id, &e)
+		if err != nil {
+			return fmt.Errorf("Failed to migrate execution %s of job %s: %v", id, jobName, err)
+		}
+		if !found {
+			continue
+		}
+		if err := to.Save(&e); err != nil {
+			return fmt.Errorf("Failed to migrate execution %s of job %s: %v", id, jobName, err)
+		}
+		if err := from.Delete(id); err != nil {
+			return fmt.Errorf("Failed to migrate execution %s of job %s: %v", id, jobName, err)
+		}
+	}
+
+	return from.Delete(jobName)
+}
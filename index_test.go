@@ -0,0 +1,247 @@
+package goflow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/philippgille/gokv"
+	"github.com/philippgille/gokv/gomap"
+)
+
+// storeExecutions stores finished executions of a job submitted at the
+// given times.
+func storeExecutions(s ExecutionStore, jobName string, times ...time.Time) []*Execution {
+	j := &Job{Name: jobName}
+	j.Add(&Task{Name: "true", Operator: Command{Cmd: "true"}})
+
+	executions := make([]*Execution, 0)
+	for _, t := range times {
+		e := j.newExecution(nil)
+		e.StartedAt = t.UTC().Format(time.RFC3339Nano)
+		e.State = StateSuccessful
+		saveNewExecution(s, e)
+		executions = append(executions, e)
+	}
+	return executions
+}
+
+func TestListExecutions(t *testing.T) {
+	s := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// two jobs, with runs every 20 minutes over several hourly buckets
+	a := storeExecutions(s, "a", start, start.Add(40*time.Minute), start.Add(80*time.Minute), start.Add(120*time.Minute))
+	b := storeExecutions(s, "b", start.Add(20*time.Minute), start.Add(60*time.Minute), start.Add(100*time.Minute))
+
+	expected := []*Execution{a[3], b[2], a[2], b[1], a[1], b[0], a[0]}
+
+	// page through everything, most recent first
+	for _, jobs := range [][]string{{"a", "b"}, nil} {
+		got := make([]*Execution, 0)
+		q := ExecutionQuery{Jobs: jobs, Limit: 3}
+		for pages := 0; pages < 5; pages++ {
+			page, next, err := s.List(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, page...)
+			if next == "" {
+				break
+			}
+			q.Cursor = next
+		}
+
+		if len(got) != len(expected) {
+			t.Fatalf("Got %d executions of jobs %v, expected %d", len(got), jobs, len(expected))
+		}
+		for ix := range expected {
+			if got[ix].ID != expected[ix].ID {
+				t.Errorf("Got execution %d submitted at %v, expected %v", ix, got[ix].StartedAt, expected[ix].StartedAt)
+			}
+		}
+	}
+
+	// since is inclusive and until exclusive
+	page, _, _ := s.List(ExecutionQuery{Since: start.Add(40 * time.Minute), Until: start.Add(100 * time.Minute)})
+	if len(page) != 3 || page[0].ID != a[2].ID || page[2].ID != a[1].ID {
+		t.Errorf("Got %d executions between since and until, expected 3", len(page))
+	}
+
+	// state and job filters
+	a[0].State = StateFailed
+	persistExecution(s, a[0])
+	page, _, _ = s.List(ExecutionQuery{Jobs: []string{"a"}, State: StateFailed})
+	if len(page) != 1 || page[0].ID != a[0].ID {
+		t.Errorf("Got %d failed executions, expected 1", len(page))
+	}
+
+	all, _ := readExecutions(s, "b")
+	if len(all) != 3 || all[0].ID != b[0].ID {
+		t.Errorf("Expected readExecutions to return all the executions of a job, oldest first")
+	}
+
+	if _, _, err := s.List(ExecutionQuery{Cursor: "!"}); err != ErrInvalidCursor {
+		t.Errorf("Expected an invalid cursor error, got %v", err)
+	}
+}
+
+func TestKVStoreDelete(t *testing.T) {
+	s := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	executions := storeExecutions(s, "job", start, start.Add(time.Minute), start.Add(time.Hour))
+
+	for _, e := range executions[1:] {
+		if err := s.Delete(e.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, found, _ := s.Get(executions[2].ID); found {
+		t.Errorf("Expected the execution to be deleted")
+	}
+	remaining, _ := readExecutions(s, "job")
+	if len(remaining) != 1 || remaining[0].ID != executions[0].ID {
+		t.Errorf("Got %d executions in the index, expected 1", len(remaining))
+	}
+	if buckets, _ := s.readBuckets("job"); len(buckets) != 1 {
+		t.Errorf("Got %d buckets, expected the empty one to be deleted", len(buckets))
+	}
+
+	// deleting again is not an error
+	if err := s.Delete(executions[2].ID); err != nil {
+		t.Errorf("Expected no error when deleting a missing execution, got %v", err)
+	}
+}
+
+// readCountingStore counts the reads of each key.
+type readCountingStore struct {
+	gokv.Store
+	reads map[string]int
+}
+
+func (s readCountingStore) Get(k string, v interface{}) (bool, error) {
+	s.reads[k]++
+	return s.Store.Get(k, v)
+}
+
+func TestKVStoreSave(t *testing.T) {
+	kv := readCountingStore{gomap.NewStore(gomap.DefaultOptions), make(map[string]int)}
+	s := NewKVStore(kv)
+	e := storeExecutions(s, "job", time.Now())[0]
+
+	// saving doesn't read the execution back
+	e.State = StateFailed
+	if err := persistExecution(s, e); err != nil {
+		t.Fatal(err)
+	}
+	if n := kv.reads[executionKey(e.ID)]; n != 0 {
+		t.Errorf("Got %d reads of the execution, expected none", n)
+	}
+	if executions, _ := readExecutions(s, "job"); len(executions) != 1 || executions[0].State != StateFailed {
+		t.Errorf("Got %d executions in the index, expected the updated execution", len(executions))
+	}
+
+	// a deleted execution is indexed again when it is saved
+	s.Delete(e.ID)
+	s.Save(e)
+	if executions, _ := readExecutions(s, "job"); len(executions) != 1 {
+		t.Errorf("Got %d executions in the index, expected 1", len(executions))
+	}
+}
+
+func TestNamespacedKeys(t *testing.T) {
+	kv := gomap.NewStore(gomap.DefaultOptions)
+	s := NewKVStore(kv)
+	e := storeExecutions(s, "job", time.Now())[0]
+
+	// the execution is not stored under its bare ID, which could be the
+	// name of a job
+	if found, _ := kv.Get(e.ID.String(), &Execution{}); found {
+		t.Errorf("Expected the execution to be stored under a namespaced key")
+	}
+	if found, _ := kv.Get(executionKey(e.ID), &Execution{}); !found {
+		t.Errorf("Expected the execution to be stored under %s", executionKey(e.ID))
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	entry := &indexEntry{ID: "0b4f1b5e-7f53-4d6b-9d0a-5c4a5e8a1f00", Submitted: "2024-01-01T00:00:00Z"}
+	if decoded, err := decodeCursor(encodeCursor(entry)); err != nil || *decoded != *entry {
+		t.Errorf("Expected the cursor to decode to %v, got %v", entry, decoded)
+	}
+
+	for _, cursor := range []string{"!", encodeCursor(&indexEntry{ID: "nope", Submitted: "2024-01-01T00:00:00Z"})} {
+		if _, err := decodeCursor(cursor); err == nil {
+			t.Errorf("Expected an error for cursor %q", cursor)
+		}
+	}
+}
+
+func TestMigrateIndex(t *testing.T) {
+	kv := gomap.NewStore(gomap.DefaultOptions)
+	s := NewKVStore(kv)
+	j := &Job{Name: "legacy"}
+	j.Add(&Task{Name: "true", Operator: Command{Cmd: "true"}})
+
+	e := j.newExecution(nil)
+	kv.Set(e.ID.String(), e)
+	kv.Set("legacy", legacyIndex{[]string{e.ID.String()}})
+
+	if err := migrateIndex(kv, s, "legacy"); err != nil {
+		t.Fatal(err)
+	}
+
+	executions, _ := readExecutions(s, "legacy")
+	if len(executions) != 1 || executions[0].ID != e.ID {
+		t.Errorf("Expected the execution to be migrated")
+	}
+	if found, _ := kv.Get("legacy", &legacyIndex{}); found {
+		t.Errorf("Expected the legacy index to be deleted")
+	}
+	if found, _ := kv.Get(e.ID.String(), &Execution{}); found {
+		t.Errorf("Expected the execution to be moved to a namespaced key")
+	}
+}
+
+func TestMigrateIndexCollisions(t *testing.T) {
+	kv := gomap.NewStore(gomap.DefaultOptions)
+	s := NewKVStore(kv)
+	e := storeExecutions(s, "job", time.Now())[0]
+	legacy := (&Job{Name: "legacy"}).newExecution(nil)
+	kv.Set(legacy.ID.String(), legacy)
+	kv.Set("other", legacyIndex{[]string{"not an id"}})
+
+	// jobs named like other records don't delete them
+	for _, name := range []string{executionKey(e.ID), "goflow:jobs", legacy.ID.String(), "other"} {
+		if err := migrateIndex(kv, s, name); err != nil {
+			t.Errorf("Got error %v for job %s, expected none", err, name)
+		}
+	}
+
+	if _, found, _ := s.Get(e.ID); !found {
+		t.Errorf("Expected the execution to be kept")
+	}
+	if jobs, _ := s.readJobs(); len(jobs) != 1 {
+		t.Errorf("Got jobs %v, expected the jobs to be kept", jobs)
+	}
+	if found, _ := kv.Get(legacy.ID.String(), &Execution{}); !found {
+		t.Errorf("Expected the legacy execution to be kept")
+	}
+	if found, _ := kv.Get("other", &legacyIndex{}); !found {
+		t.Errorf("Expected a value that isn't a legacy index to be kept")
+	}
+}
+
+// Read all the persisted executions for a given job, oldest first.
+func readExecutions(s ExecutionStore, jobName string) ([]*Execution, error) {
+	executions, _, err := s.List(ExecutionQuery{Jobs: []string{jobName}})
+	if err != nil {
+		return nil, err
+	}
+
+	// the store returns the most recent first
+	for a, b := 0, len(executions)-1; a < b; a, b = a+1, b-1 {
+		executions[a], executions[b] = executions[b], executions[a]
+	}
+	return executions, nil
+}
@@ -0,0 +1,207 @@
+package goflow
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// An interval is the period of time covered by an execution of a
+// scheduled job. A run at a cron tick covers the interval from the
+// previous tick, included, to that tick, excluded.
+type interval struct {
+	start time.Time
+	end   time.Time
+}
+
+// maxLookback bounds the search for the previous tick of a schedule.
+const maxLookback = 10 * 366 * 24 * time.Hour
+
+// previousTick returns the last tick of the schedule strictly before t.
+// Cron schedules can only be walked forward, so the search starts a
+// minute before t and looks further back until a tick is found.
+func previousTick(s cron.Schedule, t time.Time) (time.Time, bool) {
+	for window := time.Minute; window <= maxLookback; window *= 2 {
+		var prev time.Time
+		for next := s.Next(t.Add(-window)); !next.IsZero() && next.Before(t); next = s.Next(next) {
+			prev = next
+		}
+		if !prev.IsZero() {
+			return prev, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// latestInterval returns the last complete interval of the schedule at
+// time t. For a scheduled run, it is the interval ending at the tick that
+// triggered the run.
+func latestInterval(s cron.Schedule, t time.Time) (interval, bool) {
+	end, ok := previousTick(s, t.Add(time.Second))
+	if !ok {
+		return interval{}, false
+	}
+	start, ok := previousTick(s, end)
+	if !ok {
+		return interval{}, false
+	}
+	return interval{start, end}, true
+}
+
+// intervalsBetween returns the intervals of the schedule that are
+// entirely within start and end, in order. It returns an error if there
+// are more than max of them.
+func intervalsBetween(s cron.Schedule, start, end time.Time, max int) ([]interval, error) {
+	intervals := make([]interval, 0)
+
+	tick := s.Next(start.Add(-time.Second))
+	for !tick.IsZero() && tick.Before(start) {
+		tick = s.Next(tick)
+	}
+
+	for !tick.IsZero() {
+		next := s.Next(tick)
+		if next.IsZero() || next.After(end) {
+			break
+		}
+		if len(intervals) == max {
+			return nil, fmt.Errorf("More than %d intervals between %v and %v", max, start, end)
+		}
+		intervals = append(intervals, interval{tick, next})
+		tick = next
+	}
+
+	return intervals, nil
+}
+
+// setInterval records the interval covered by an execution.
+func (e *Execution) setInterval(i interval) {
+	e.IntervalStart = i.start.UTC().Format(time.RFC3339)
+	e.IntervalEnd = i.end.UTC().Format(time.RFC3339)
+}
+
+// jobInterval returns the last complete interval of a job's schedule at
+// time t. It returns false if the job has no schedule.
+func (g *Goflow) jobInterval(j *Job, t time.Time) (interval, bool) {
+	if j.Schedule == "" {
+		return interval{}, false
+	}
+	s, err := g.parser.Parse(j.Schedule)
+	if err != nil {
+		return interval{}, false
+	}
+	return latestInterval(s, t)
+}
+
+// maxBackfill is the maximum number of executions created by a backfill.
+const maxBackfill = 1000
+
+var errNoSchedule = errors.New("Job has no schedule")
+
+// backfill creates an execution of a job for each interval of its
+// schedule between start and end that doesn't have one yet. The
+// executions are run in a new goroutine, at most concurrency at a time,
+// in the order of their intervals. It returns the IDs of the new
+// executions.
+func (g *Goflow) backfill(jobName string, start, end time.Time, concurrency int) ([]uuid.UUID, error) {
+	if g.isClosing() {
+		return nil, errShuttingDown
+	}
+
+	j := g.Jobs[jobName]()
+	if j.Schedule == "" {
+		return nil, errNoSchedule
+	}
+
+	s, err := g.parser.Parse(j.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	intervals, err := intervalsBetween(s, start, end, maxBackfill)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.runIntervals(j, intervals, concurrency)
+}
+
+// runIntervals creates an execution of a job for each of the intervals
+// that doesn't have one yet, and runs them in a new goroutine, at most
+// concurrency at a time. It returns the IDs of the new executions.
+func (g *Goflow) runIntervals(j *Job, intervals []interval, concurrency int) ([]uuid.UUID, error) {
+	params, err := j.resolveParams(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// skip the intervals that already have an execution
+	covered := make(map[string]bool)
+	for _, i := range intervals {
+		covered[i.start.UTC().Format(time.RFC3339)] = false
+	}
+	err = eachExecution(g.Executions, ExecutionQuery{Jobs: []string{j.Name}}, func(e *Execution) bool {
+		if _, ok := covered[e.IntervalStart]; ok {
+			covered[e.IntervalStart] = true
+		}
+		return true
+	})
+	if err != nil {
+		return nil, storeError{err}
+	}
+
+	// the executions are persisted up front, so that they are picked up
+	// by recovery if Goflow stops before running them
+	executions := make([]*Execution, 0)
+	ids := make([]uuid.UUID, 0)
+	for _, i := range intervals {
+		e := j.newExecution(params)
+		e.setInterval(i)
+		if covered[e.IntervalStart] {
+			continue
+		}
+		if err := saveNewExecution(g.Executions, e); err != nil {
+			// the executions saved so far are not run
+			for _, saved := range executions {
+				finishUnstarted(g, saved, StateFailed, err.Error())
+			}
+			return nil, err
+		}
+		executions = append(executions, e)
+		ids = append(ids, e.ID)
+	}
+
+	log.Printf("job=%v, msg=running %d intervals", j.Name, len(executions))
+
+	// the executions are subject to the job's MaxActiveRuns and overlap
+	// policy, and take a slot until they finish or are skipped. The ones
+	// not started when Goflow stops are left to recovery.
+	go func() {
+		slots := make(chan struct{}, concurrency)
+		for _, e := range executions {
+			select {
+			case slots <- struct{}{}:
+			case <-g.stop:
+				return
+			}
+			if g.isClosing() {
+				return
+			}
+			err := g.startNew(g.Jobs[j.Name](), e, func() { <-slots })
+			if err != nil && err != errSkipped {
+				log.Printf("jobID=%v, job=%v, msg=not run, error=%v", e.ID, j.Name, err)
+				return
+			}
+		}
+	}()
+
+	return ids, nil
+}
@@ -0,0 +1,67 @@
+package goflow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestPreviousTick(t *testing.T) {
+	at := time.Date(2024, 3, 10, 12, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"*/5 * * * *", time.Date(2024, 3, 10, 12, 25, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 6 *", time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		s, _ := cron.ParseStandard(c.spec)
+		if prev, ok := previousTick(s, at); !ok || !prev.Equal(c.expected) {
+			t.Errorf("Got %v for %s, expected %v", prev, c.spec, c.expected)
+		}
+	}
+}
+
+func TestLatestInterval(t *testing.T) {
+	s, _ := cron.ParseStandard("0 * * * *")
+
+	// a run triggered at a tick covers the hour before it
+	for _, at := range []time.Time{
+		time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 10, 12, 0, 0, 500, time.UTC),
+		time.Date(2024, 3, 10, 12, 59, 0, 0, time.UTC),
+	} {
+		i, ok := latestInterval(s, at)
+		if !ok || !i.start.Equal(time.Date(2024, 3, 10, 11, 0, 0, 0, time.UTC)) || !i.end.Equal(time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)) {
+			t.Errorf("Got interval %v - %v at %v", i.start, i.end, at)
+		}
+	}
+}
+
+func TestIntervalsBetween(t *testing.T) {
+	s, _ := cron.ParseStandard("0 * * * *")
+	start := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 10, 3, 30, 0, 0, time.UTC)
+
+	intervals, err := intervalsBetween(s, start, end, 10)
+	if err != nil {
+		t.Fatalf("Got error %v, expected none", err)
+	}
+	if len(intervals) != 3 {
+		t.Fatalf("Got %d intervals, expected 3", len(intervals))
+	}
+	if !intervals[0].start.Equal(start) || !intervals[2].end.Equal(start.Add(3*time.Hour)) {
+		t.Errorf("Got intervals %v", intervals)
+	}
+
+	if _, err := intervalsBetween(s, start, end, 2); err == nil {
+		t.Errorf("Expected an error for too many intervals")
+	}
+}
@@ -1,55 +1,87 @@
 package goflow
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
 	"time"
 
-	"github.com/philippgille/gokv"
+	"github.com/robfig/cron/v3"
 )
 
 // A Job is a workflow consisting of independent and dependent tasks
 // organized into a graph.
 type Job struct {
-	Name     string
-	Tasks    map[string]*Task
-	Schedule string
-	Dag      dag
-	Active   bool
-	state    state
-	tasks    []string
+	Name          string
+	Tasks         map[string]*Task
+	Schedule      string
+	Dag           dag
+	Active        bool
+	TaskTimeout   time.Duration
+	Params        map[string]Param
+	Catchup       CatchupPolicy
+	MaxActiveRuns int
+	Overlap       OverlapPolicy
+	WeightRule    WeightRule
+	state         State
+	tasks         []string
+	errs          []error
+	slots         *taskSlots
 	sync.RWMutex
 }
 
-// Jobs and tasks are stateful.
-type state string
+// A State is the state of an execution or of one of its tasks.
+type State string
 
+// The states of executions and tasks.
 const (
-	none       state = "notstarted"
-	running    state = "running"
-	upForRetry state = "upforretry"
-	skipped    state = "skipped"
-	failed     state = "failed"
-	successful state = "successful"
+	// StateNotStarted is the state of a task that hasn't run yet.
+	StateNotStarted State = "notstarted"
+	// StateRunning is the state of a running execution or task.
+	StateRunning State = "running"
+	// StateUpForRetry is the state of a task that failed and will run
+	// again.
+	StateUpForRetry State = "upforretry"
+	// StateQueued is the state of a task waiting for a slot of the
+	// MaxRunningTasks or Pools options.
+	StateQueued State = "queued"
+	// StateSkipped is the state of an execution or task that didn't run.
+	StateSkipped State = "skipped"
+	// StateFailed is the state of a failed execution or task.
+	StateFailed State = "failed"
+	// StateSuccessful is the state of a successful execution or task.
+	StateSuccessful State = "successful"
+	// StateCancelled is the state of a cancelled execution or task.
+	StateCancelled State = "cancelled"
 )
 
-func (j *Job) loadState() state {
+// finished returns true if the state is final.
+func (s State) finished() bool {
+	return s == StateSuccessful || s == StateSkipped || s == StateFailed || s == StateCancelled
+}
+
+func (j *Job) loadState() State {
 	if !j.allDone() {
-		j.storeState(running)
+		j.storeState(StateRunning)
 	}
-	if j.allSuccessful() {
-		j.storeState(successful)
+	// Skipped tasks don't fail the job
+	if j.allDone() && !j.anyFailed() && !j.anyCancelled() {
+		j.storeState(StateSuccessful)
 	}
 	if j.allDone() && j.anyFailed() {
-		j.storeState(failed)
+		j.storeState(StateFailed)
+	}
+	if j.allDone() && j.anyCancelled() {
+		j.storeState(StateCancelled)
 	}
 	return j.state
 }
 
-func (j *Job) loadTaskState(task string) state {
+func (j *Job) loadTaskState(task string) State {
 	j.RLock()
-	result := none
+	result := StateNotStarted
 	for _, t := range j.Tasks {
 		if t.Name == task {
 			result = t.state
@@ -60,13 +92,13 @@ func (j *Job) loadTaskState(task string) state {
 	return result
 }
 
-func (j *Job) storeState(value state) {
+func (j *Job) storeState(value State) {
 	j.Lock()
 	j.state = value
 	j.Unlock()
 }
 
-func (j *Job) storeTaskState(task string, value state) {
+func (j *Job) storeTaskState(task string, value State) {
 	j.Lock()
 	for _, t := range j.Tasks {
 		if t.Name == task {
@@ -77,8 +109,11 @@ func (j *Job) storeTaskState(task string, value state) {
 }
 
 type writeOp struct {
-	key string
-	val state
+	key     string
+	val     State
+	err     string
+	result  interface{}
+	attempt *TaskAttempt
 }
 
 // Initialize a job.
@@ -86,26 +121,44 @@ func (j *Job) initialize() *Job {
 	j.Dag = make(dag)
 	j.Tasks = make(map[string]*Task)
 	j.tasks = make([]string, 0)
-	j.storeState(none)
+	j.storeState(StateNotStarted)
 	return j
 }
 
+// restore sets the task states of the job from a persisted execution, so
+// that running the job continues the execution. Tasks that had not
+// finished are reset so that they run again.
+func (j *Job) restore(e *Execution) {
+	for ix, task := range e.TaskExecutions {
+		if !task.State.finished() {
+			e.TaskExecutions[ix].State = StateNotStarted
+		}
+		j.storeTaskState(task.Name, e.TaskExecutions[ix].State)
+	}
+	e.State = j.loadState()
+}
+
 // Add a task to a job.
 func (j *Job) Add(t *Task) *Job {
 	if j.Dag == nil {
 		j.initialize()
 	}
 
-	if !(t.TriggerRule == allDone || t.TriggerRule == allSuccessful) {
-		t.TriggerRule = allSuccessful
+	if t.TriggerRule == "" {
+		t.TriggerRule = AllSuccessful
 	}
 
 	t.remaining = t.Retries
 
+	if _, ok := j.Tasks[t.Name]; ok {
+		j.errs = append(j.errs, fmt.Errorf("Duplicate task name %s in job %s", t.Name, j.Name))
+	} else {
+		j.tasks = append(j.tasks, t.Name)
+		j.Dag.addNode(t.Name)
+	}
+
 	j.Tasks[t.Name] = t
-	j.tasks = append(j.tasks, t.Name)
-	j.Dag.addNode(t.Name)
-	j.storeTaskState(t.Name, none)
+	j.storeTaskState(t.Name, StateNotStarted)
 	return j
 }
 
@@ -119,88 +172,184 @@ func (j *Job) Task(name string) *Task {
 // waits for the independent task to finish before starting
 // execution.
 func (j *Job) SetDownstream(ind, dep *Task) *Job {
+	if j.Dag == nil {
+		j.initialize()
+	}
+
+	for _, t := range []*Task{ind, dep} {
+		if t == nil {
+			j.errs = append(j.errs, fmt.Errorf("Dependency on a task that is not part of job %s", j.Name))
+			return j
+		}
+		if j.Tasks[t.Name] != t {
+			j.errs = append(j.errs, fmt.Errorf("Dependency on task %s, which is not part of job %s", t.Name, j.Name))
+			return j
+		}
+	}
+
 	j.Dag.setDownstream(ind.Name, dep.Name)
 	return j
 }
 
-func (j *Job) run(store gokv.Store, e *execution) error {
+// scheduleParser accepts cron specs with or without the seconds field.
+var scheduleParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// Validate checks that a job is well-formed. It reports an empty job
+// name, an invalid cron schedule, an unknown catch-up policy, overlap
+// policy or weight rule, a negative MaxActiveRuns, duplicate or empty
+// task names, unknown trigger rules, dependencies on tasks that were
+// never added, cycles in the graph of tasks, and params with an unknown
+// type or a default of the wrong type.
+func (j *Job) Validate() error {
+	errs := make([]error, 0)
+
+	if j.Name == "" {
+		errs = append(errs, errors.New("Job name is empty"))
+	}
+
+	if j.Schedule != "" {
+		if _, err := scheduleParser.Parse(j.Schedule); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid schedule %q for job %s: %v", j.Schedule, j.Name, err))
+		}
+	} else if j.Active {
+		errs = append(errs, fmt.Errorf("Job %s is active but has no schedule", j.Name))
+	}
+
+	if !j.Catchup.valid() {
+		errs = append(errs, fmt.Errorf("Invalid catch-up policy %q for job %s", j.Catchup, j.Name))
+	}
+
+	if j.MaxActiveRuns < 0 {
+		errs = append(errs, fmt.Errorf("Negative MaxActiveRuns for job %s", j.Name))
+	}
+	if !j.Overlap.valid() {
+		errs = append(errs, fmt.Errorf("Invalid overlap policy %q for job %s", j.Overlap, j.Name))
+	}
+	if !j.WeightRule.valid() {
+		errs = append(errs, fmt.Errorf("Invalid weight rule %q for job %s", j.WeightRule, j.Name))
+	}
+
+	errs = append(errs, j.errs...)
+	errs = append(errs, j.validateParams()...)
+
+	for _, name := range j.tasks {
+		task := j.Tasks[name]
+		if task.Name == "" {
+			errs = append(errs, fmt.Errorf("Task name is empty in job %s", j.Name))
+		}
+		if !task.TriggerRule.valid() {
+			errs = append(errs, fmt.Errorf("Invalid trigger rule %q for task %s", task.TriggerRule, task.Name))
+		}
+	}
+
+	if cycle := j.Dag.cycle(); len(cycle) > 0 {
+		errs = append(errs, fmt.Errorf("Cycle in job %s between tasks %v", j.Name, cycle))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (j *Job) run(ctx context.Context, store ExecutionStore, e *Execution) error {
 
-	if !j.Dag.validate() {
-		return fmt.Errorf("Invalid Dag for job %s", j.Name)
+	if err := j.Validate(); err != nil {
+		return err
+	}
+
+	// Tasks run with a context scoped to this execution
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Tasks without their own timeout inherit the job default, and all
+	// tasks share the engine's slots
+	for _, task := range j.Tasks {
+		if task.Timeout == 0 {
+			task.Timeout = j.TaskTimeout
+		}
+		task.slots = j.slots
+		task.weight = j.weight(task)
 	}
 
 	log.Printf("jobID=%v, jobname=%v, msg=starting", e.ID, j.Name)
 
 	writes := make(chan writeOp)
+	done := ctx.Done()
 
 	for {
+		// Skipping a task can unblock its downstream tasks, so the tasks
+		// are checked again before waiting for updates
+		skipping := false
+
 		for _, task := range j.Tasks {
 
+			// Don't start anything once the execution is cancelled
+			if ctx.Err() != nil {
+				break
+			}
+
 			// Start the independent tasks
 			v := j.loadTaskState(task.Name)
-			if v == none && !j.Dag.isDownstream(task.Name) {
-				j.storeTaskState(task.Name, running)
-				log.Printf("jobID=%v, job=%v, task=%v, msg=starting", e.ID, j.Name, task.Name)
-				go task.run(writes)
+			if v == StateNotStarted && !j.Dag.isDownstream(task.Name) {
+				j.start(ctx, e, task, writes)
 			}
 
 			// Start the tasks that need to be re-tried
-			if v == upForRetry {
-				task.RetryDelay.wait(task.Name, task.Retries-task.remaining)
+			if v == StateUpForRetry {
+				attempt := task.Retries - task.remaining
 				task.remaining = task.remaining - 1
-				j.storeTaskState(task.Name, running)
+				task.attempt = e.nextAttempt(task.Name)
+				j.storeTaskState(task.Name, StateRunning)
 				log.Printf("jobID=%v, job=%v, task=%v, msg=starting", e.ID, j.Name, task.Name)
-				go task.run(writes)
+				go task.retry(j.taskContext(ctx, e, task.Name), writes, attempt)
 			}
 
-			// If dependencies are done, start the dependent tasks
-			if v == none && j.Dag.isDownstream(task.Name) {
-				upstreamDone := true
-				upstreamSuccessful := true
+			// If the trigger rule is met, start the dependent tasks
+			if v == StateNotStarted && j.Dag.isDownstream(task.Name) {
+				upstream := make([]State, 0)
 				for _, us := range j.Dag.dependencies(task.Name) {
-					w := j.loadTaskState(us)
-					if w == none || w == running || w == upForRetry {
-						upstreamDone = false
-					}
-					if w != successful {
-						upstreamSuccessful = false
-					}
+					upstream = append(upstream, j.loadTaskState(us))
 				}
 
-				if upstreamDone && task.TriggerRule == allDone {
-					j.storeTaskState(task.Name, running)
-					log.Printf("jobID=%v, job=%v, task=%v, msg=starting", e.ID, j.Name, task.Name)
-					go task.run(writes)
-				}
+				run, skip := task.TriggerRule.evaluate(upstream)
 
-				if upstreamSuccessful && task.TriggerRule == allSuccessful {
-					j.storeTaskState(task.Name, running)
-					log.Printf("jobID=%v, job=%v, task=%v, msg=starting", e.ID, j.Name, task.Name)
-					go task.run(writes)
+				if run {
+					j.start(ctx, e, task, writes)
 				}
 
-				if upstreamDone && !upstreamSuccessful && task.TriggerRule == allSuccessful {
-					j.storeTaskState(task.Name, skipped)
-					log.Printf("jobID=%v, job=%v, task=%v, msg=skipping", e.ID, j.Name, task.Name)
-					go task.skip(writes)
+				if skip {
+					j.update(store, e, writeOp{key: task.Name, val: StateSkipped})
+					skipping = true
 				}
-
 			}
 		}
 
-		// Receive updates on task state
-		write := <-writes
-		j.storeTaskState(write.key, write.val)
-		log.Printf("jobID=%v, job=%v, task=%v, msg=%v", e.ID, j.Name, write.key, write.val)
-
-		// Sync to store
-		e.State = j.loadState()
-		e.ModifiedTimestamp = time.Now().UTC().Format(time.RFC3339Nano)
-		syncStateToStore(store, e, write.key, write.val)
-
 		if j.allDone() {
 			break
 		}
+
+		if skipping {
+			continue
+		}
+
+		select {
+
+		// Receive updates on task state
+		case write := <-writes:
+			j.update(store, e, write)
+
+		// Cancel the tasks that haven't started yet. The running tasks
+		// see the cancelled context and report back on their own.
+		case <-done:
+			done = nil
+			log.Printf("jobID=%v, job=%v, msg=cancelling", e.ID, j.Name)
+			for _, task := range j.Tasks {
+				v := j.loadTaskState(task.Name)
+				if v == StateNotStarted || v == StateUpForRetry {
+					j.update(store, e, writeOp{key: task.Name, val: StateCancelled, err: errCancelled.Error()})
+				}
+			}
+		}
 	}
 
 	log.Printf("jobID=%v, job=%v, msg=%v", e.ID, j.Name, j.loadState())
@@ -208,11 +357,68 @@ func (j *Job) run(store gokv.Store, e *execution) error {
 	return nil
 }
 
+// weight returns the effective priority of a task, according to the
+// job's weight rule.
+func (j *Job) weight(task *Task) int {
+	switch j.WeightRule {
+	case WeightDownstream:
+		return task.Priority + len(j.Dag.descendants(task.Name))
+	case WeightUpstream:
+		return task.Priority + len(j.Dag.ancestors(task.Name))
+	}
+	return task.Priority
+}
+
+// start marks a task as running and runs it in a new goroutine.
+func (j *Job) start(ctx context.Context, e *Execution, task *Task, writes chan writeOp) {
+	task.attempt = e.nextAttempt(task.Name)
+	j.storeTaskState(task.Name, StateRunning)
+	log.Printf("jobID=%v, job=%v, task=%v, msg=starting", e.ID, j.Name, task.Name)
+	go task.run(j.taskContext(ctx, e, task.Name), writes)
+}
+
+// taskContext adds the params of the execution, the results of the
+// upstream tasks and the template data to the context passed to a task's
+// operator.
+func (j *Job) taskContext(ctx context.Context, e *Execution, taskName string) context.Context {
+	results := make(map[string]interface{})
+	for _, us := range j.Dag.dependencies(taskName) {
+		for _, t := range e.TaskExecutions {
+			if t.Name == us {
+				results[us] = t.Result
+			}
+		}
+	}
+	ctx = context.WithValue(ctx, paramsKey, e.Params)
+	ctx = context.WithValue(ctx, templateDataKey, newTemplateData(e, taskName, results))
+	return context.WithValue(ctx, upstreamResultsKey, results)
+}
+
+// update applies a task state change to the job and syncs it to the store.
+func (j *Job) update(store ExecutionStore, e *Execution, write writeOp) {
+	j.storeTaskState(write.key, write.val)
+	switch {
+	case write.val == StateRunning:
+		// already logged when the task was started
+	case write.err != "":
+		log.Printf("jobID=%v, job=%v, task=%v, msg=%v, error=%v", e.ID, j.Name, write.key, write.val, write.err)
+	default:
+		log.Printf("jobID=%v, job=%v, task=%v, msg=%v", e.ID, j.Name, write.key, write.val)
+	}
+
+	// Sync to store
+	e.State = j.loadState()
+	e.ModifiedTimestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	if err := syncStateToStore(store, e, write); err != nil {
+		log.Printf("jobID=%v, job=%v, task=%v, msg=failed to save the state, error=%v", e.ID, j.Name, write.key, err)
+	}
+}
+
 func (j *Job) allDone() bool {
 	j.RLock()
 	out := true
 	for _, t := range j.Tasks {
-		if t.state == none || t.state == running || t.state == upForRetry {
+		if t.state == StateNotStarted || t.state == StateQueued || t.state == StateRunning || t.state == StateUpForRetry {
 			out = false
 		}
 	}
@@ -220,23 +426,23 @@ func (j *Job) allDone() bool {
 	return out
 }
 
-func (j *Job) allSuccessful() bool {
+func (j *Job) anyFailed() bool {
 	j.RLock()
-	out := true
+	out := false
 	for _, t := range j.Tasks {
-		if t.state != successful {
-			out = false
+		if t.state == StateFailed {
+			out = true
 		}
 	}
 	j.RUnlock()
 	return out
 }
 
-func (j *Job) anyFailed() bool {
+func (j *Job) anyCancelled() bool {
 	j.RLock()
 	out := false
 	for _, t := range j.Tasks {
-		if t.state == failed {
+		if t.state == StateCancelled {
 			out = true
 		}
 	}
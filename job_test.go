@@ -1,7 +1,10 @@
 package goflow
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/philippgille/gokv/gomap"
 )
@@ -61,9 +64,9 @@ func TestJob(t *testing.T) {
 	j.SetDownstream(j.Task("whoops-with-exponential-backoff"), j.Task("totally-skippable"))
 	j.SetDownstream(j.Task("totally-skippable"), j.Task("clean-up"))
 
-	store := gomap.NewStore(gomap.DefaultOptions)
+	store := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
 
-	go j.run(store, j.newExecution())
+	go j.run(context.Background(), store, j.newExecution(nil))
 
 	for {
 		if j.allDone() {
@@ -71,32 +74,32 @@ func TestJob(t *testing.T) {
 		}
 	}
 
-	if j.loadTaskState("add-one-one") != successful {
-		t.Errorf("Got status %v, expected %v", j.loadTaskState("add-one-one"), successful)
+	if j.loadTaskState("add-one-one") != StateSuccessful {
+		t.Errorf("Got status %v, expected %v", j.loadTaskState("add-one-one"), StateSuccessful)
 	}
-	if j.loadTaskState("sleep-two") != successful {
-		t.Errorf("Got status %v, expected %v", j.loadTaskState("sleep-two"), successful)
+	if j.loadTaskState("sleep-two") != StateSuccessful {
+		t.Errorf("Got status %v, expected %v", j.loadTaskState("sleep-two"), StateSuccessful)
 	}
-	if j.loadTaskState("add-two-four") != successful {
-		t.Errorf("Got status %v, expected %v", j.loadTaskState("add-two-four"), successful)
+	if j.loadTaskState("add-two-four") != StateSuccessful {
+		t.Errorf("Got status %v, expected %v", j.loadTaskState("add-two-four"), StateSuccessful)
 	}
-	if j.loadTaskState("add-three-four") != successful {
-		t.Errorf("Got status %v, expected %v", j.loadTaskState("add-three-four"), successful)
+	if j.loadTaskState("add-three-four") != StateSuccessful {
+		t.Errorf("Got status %v, expected %v", j.loadTaskState("add-three-four"), StateSuccessful)
 	}
-	if j.loadTaskState("whoops-with-constant-delay") != failed {
-		t.Errorf("Got status %v, expected %v", j.loadTaskState("whoops-with-constant-delay"), failed)
+	if j.loadTaskState("whoops-with-constant-delay") != StateFailed {
+		t.Errorf("Got status %v, expected %v", j.loadTaskState("whoops-with-constant-delay"), StateFailed)
 	}
-	if j.loadTaskState("whoops-with-exponential-backoff") != failed {
-		t.Errorf("Got status %v, expected %v", j.loadTaskState("whoops-with-exponential-backoff"), failed)
+	if j.loadTaskState("whoops-with-exponential-backoff") != StateFailed {
+		t.Errorf("Got status %v, expected %v", j.loadTaskState("whoops-with-exponential-backoff"), StateFailed)
 	}
-	if j.loadTaskState("totally-skippable") != skipped {
-		t.Errorf("Got status %v, expected %v", j.loadTaskState("totally-skippable"), skipped)
+	if j.loadTaskState("totally-skippable") != StateSkipped {
+		t.Errorf("Got status %v, expected %v", j.loadTaskState("totally-skippable"), StateSkipped)
 	}
-	if j.loadTaskState("clean-up") != successful {
-		t.Errorf("Got status %v, expected %v", j.loadTaskState("clean-up"), successful)
+	if j.loadTaskState("clean-up") != StateSuccessful {
+		t.Errorf("Got status %v, expected %v", j.loadTaskState("clean-up"), StateSuccessful)
 	}
-	if j.loadTaskState("failure") != failed {
-		t.Errorf("Got status %v, expected %v", j.loadTaskState("failure"), failed)
+	if j.loadTaskState("failure") != StateFailed {
+		t.Errorf("Got status %v, expected %v", j.loadTaskState("failure"), StateFailed)
 	}
 
 }
@@ -116,7 +119,214 @@ func TestCyclicJob(t *testing.T) {
 	j.SetDownstream(j.Task("add-two-four"), j.Task("add-three-four"))
 	j.SetDownstream(j.Task("add-three-four"), j.Task("add-two-four"))
 
-	store := gomap.NewStore(gomap.DefaultOptions)
+	store := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
 
-	j.run(store, j.newExecution())
+	j.run(context.Background(), store, j.newExecution(nil))
+}
+
+func TestTaskTimeout(t *testing.T) {
+	j := &Job{Name: "timeout", Schedule: "* * * * *", TaskTimeout: 100 * time.Millisecond}
+
+	j.Add(&Task{
+		Name:     "sleep-ten",
+		Operator: Command{Cmd: "sleep", Args: []string{"10"}},
+	})
+	j.Add(&Task{
+		Name:       "sleep-ten-with-retry",
+		Operator:   Command{Cmd: "sleep", Args: []string{"10"}},
+		Timeout:    200 * time.Millisecond,
+		Retries:    1,
+		RetryDelay: ConstantDelay{0},
+	})
+
+	store := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+	e := j.newExecution(nil)
+
+	start := time.Now()
+	j.run(context.Background(), store, e)
+
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Tasks were not stopped after their timeout")
+	}
+
+	for _, task := range e.TaskExecutions {
+		if task.State != StateFailed {
+			t.Errorf("Got status %v, expected %v", task.State, StateFailed)
+		}
+		if !strings.Contains(task.Error, "timed out") {
+			t.Errorf("Got error %q, expected a timeout", task.Error)
+		}
+	}
+}
+
+func TestCancelledJob(t *testing.T) {
+	j := &Job{Name: "cancelled", Schedule: "* * * * *"}
+
+	j.Add(&Task{
+		Name:     "sleep-ten",
+		Operator: Command{Cmd: "sleep", Args: []string{"10"}},
+	})
+	j.Add(&Task{
+		Name:     "add-one-one",
+		Operator: Command{Cmd: "sh", Args: []string{"-c", "echo $((1 + 1))"}},
+	})
+
+	j.SetDownstream(j.Task("sleep-ten"), j.Task("add-one-one"))
+
+	store := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+	e := j.newExecution(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	j.run(ctx, store, e)
+
+	if e.State != StateCancelled {
+		t.Errorf("Got status %v, expected %v", e.State, StateCancelled)
+	}
+	for _, task := range e.TaskExecutions {
+		if task.State != StateCancelled {
+			t.Errorf("Got status %v for %v, expected %v", task.State, task.Name, StateCancelled)
+		}
+	}
+}
+
+// addUpstream adds up the integer results of the upstream tasks.
+type addUpstream struct{}
+
+func (o addUpstream) Run() (interface{}, error) {
+	return o.RunContext(context.Background())
+}
+
+func (o addUpstream) RunContext(ctx context.Context) (interface{}, error) {
+	sum := 0
+	for _, result := range UpstreamResults(ctx) {
+		sum += result.(int)
+	}
+	return sum, nil
+}
+
+func TestUpstreamResults(t *testing.T) {
+	j := &Job{Name: "results", Schedule: "* * * * *"}
+
+	j.Add(&Task{Name: "two-plus-three", Operator: PositiveAddition{2, 3}})
+	j.Add(&Task{Name: "one-plus-one", Operator: PositiveAddition{1, 1}})
+	j.Add(&Task{Name: "sum", Operator: addUpstream{}})
+
+	j.SetDownstream(j.Task("two-plus-three"), j.Task("sum"))
+	j.SetDownstream(j.Task("one-plus-one"), j.Task("sum"))
+
+	store := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+	e := j.newExecution(nil)
+	j.run(context.Background(), store, e)
+
+	stored, _, _ := store.Get(e.ID)
+	for _, task := range stored.TaskExecutions {
+		if task.Name == "sum" && task.Result != float64(7) {
+			t.Errorf("Got result %v, expected %v", task.Result, 7)
+		}
+	}
+}
+
+func TestTaskAttemptOutput(t *testing.T) {
+	j := &Job{Name: "output", Schedule: "* * * * *"}
+
+	j.Add(&Task{
+		Name:       "fail-loudly",
+		Operator:   Command{Cmd: "sh", Args: []string{"-c", "echo out; echo err >&2; exit 3"}},
+		Retries:    1,
+		RetryDelay: ConstantDelay{0},
+	})
+
+	store := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+	e := j.newExecution(nil)
+	j.run(context.Background(), store, e)
+
+	attempts := e.TaskExecutions[0].Attempts
+	if len(attempts) != 2 {
+		t.Fatalf("Got %d attempts, expected %d", len(attempts), 2)
+	}
+
+	for i, a := range attempts {
+		if a.Attempt != i+1 {
+			t.Errorf("Got attempt number %d, expected %d", a.Attempt, i+1)
+		}
+		if a.Stdout != "out\n" || a.Stderr != "err\n" {
+			t.Errorf("Got stdout %q and stderr %q", a.Stdout, a.Stderr)
+		}
+		if a.ExitCode == nil || *a.ExitCode != 3 {
+			t.Errorf("Got exit code %v, expected %d", a.ExitCode, 3)
+		}
+		if a.Error == "" {
+			t.Errorf("Expected an error message")
+		}
+		if a.StartedAt == "" || a.EndedAt == "" || a.EndedAt < a.StartedAt {
+			t.Errorf("Got start %q and end %q", a.StartedAt, a.EndedAt)
+		}
+	}
+
+	if attempts[0].State != StateUpForRetry {
+		t.Errorf("Got status %v, expected %v", attempts[0].State, StateUpForRetry)
+	}
+	if attempts[1].State != StateFailed {
+		t.Errorf("Got status %v, expected %v", attempts[1].State, StateFailed)
+	}
+}
+
+func TestJobWithUnknownTriggerRule(t *testing.T) {
+	j := &Job{Name: "unknown-rule", Schedule: "* * * * *"}
+
+	j.Add(&Task{
+		Name:        "add-one-one",
+		Operator:    Command{Cmd: "sh", Args: []string{"-c", "echo $((1 + 1))"}},
+		TriggerRule: "bla",
+	})
+
+	if j.Task("add-one-one").TriggerRule != "bla" {
+		t.Errorf("Unknown trigger rule was replaced")
+	}
+
+	store := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+
+	if err := j.run(context.Background(), store, j.newExecution(nil)); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
+
+func TestJobValidate(t *testing.T) {
+	j := &Job{Name: "valid", Schedule: "* * * * *", Active: true}
+	j.Add(&Task{Name: "a", Operator: PositiveAddition{1, 1}})
+	j.Add(&Task{Name: "b", Operator: PositiveAddition{1, 1}})
+	j.SetDownstream(j.Task("a"), j.Task("b"))
+
+	if err := j.Validate(); err != nil {
+		t.Errorf("Valid job failed validation check: %v", err)
+	}
+
+	j = &Job{Schedule: "every minute", Active: true}
+	j.Add(&Task{Name: "a", Operator: PositiveAddition{1, 1}})
+	j.Add(&Task{Name: "a", Operator: PositiveAddition{1, 1}})
+	j.Add(&Task{Name: "b", Operator: PositiveAddition{1, 1}})
+	j.Add(&Task{Name: "c", Operator: PositiveAddition{1, 1}})
+	j.SetDownstream(j.Task("a"), j.Task("bla"))
+	j.SetDownstream(j.Task("a"), &Task{Name: "d"})
+	j.SetDownstream(j.Task("b"), j.Task("c"))
+	j.SetDownstream(j.Task("c"), j.Task("b"))
+
+	err := j.Validate()
+	if err == nil {
+		t.Fatalf("Invalid job passed validation check")
+	}
+
+	for _, expected := range []string{
+		"Job name is empty",
+		"Invalid schedule",
+		"Duplicate task name a",
+		"not part of job",
+		"Dependency on task d",
+		"between tasks [b c]",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Got error %q, expected it to contain %q", err, expected)
+		}
+	}
 }
@@ -0,0 +1,171 @@
+package goflow
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/philippgille/gokv"
+)
+
+// KVStore is the default ExecutionStore. It keeps the executions in a
+// gokv.Store, under keys in the goflow namespace:
+//
+//	goflow:execution:<id>        an execution
+//	goflow:indexed:<id>          set once the execution is in the index
+//	goflow:jobs                  the jobs that have executions
+//	goflow:buckets:<job>         the index buckets of a job, oldest first
+//	goflow:index:<job>:<bucket>  the executions of a job submitted in that hour
+//
+// Listing executions by state reads the executions of the selected jobs
+// and filters them.
+type KVStore struct {
+	store gokv.Store
+}
+
+// NewKVStore returns an ExecutionStore that keeps the executions in a
+// gokv.Store.
+func NewKVStore(s gokv.Store) *KVStore {
+	return &KVStore{store: s}
+}
+
+func executionKey(id uuid.UUID) string {
+	return "goflow:execution:" + id.String()
+}
+
+func indexedKey(id uuid.UUID) string {
+	return "goflow:indexed:" + id.String()
+}
+
+// Save creates or replaces an execution. A new execution is added to the
+// index of its job, which a small marker records so that the execution
+// itself isn't read back on every save.
+func (s *KVStore) Save(e *Execution) error {
+	var indexed bool
+	if _, err := s.store.Get(indexedKey(e.ID), &indexed); err != nil {
+		return err
+	}
+	if err := s.store.Set(executionKey(e.ID), e); err != nil {
+		return err
+	}
+	if indexed {
+		return nil
+	}
+	if err := s.index(e); err != nil {
+		return err
+	}
+	return s.store.Set(indexedKey(e.ID), true)
+}
+
+// Get reads an execution by its ID.
+func (s *KVStore) Get(id uuid.UUID) (*Execution, bool, error) {
+	e := Execution{}
+	found, err := s.store.Get(executionKey(id), &e)
+	if err != nil || found {
+		return &e, found, err
+	}
+
+	// executions saved by earlier versions are under their bare ID
+	found, err = s.store.Get(id.String(), &e)
+	return &e, found, err
+}
+
+// Delete removes an execution and its index entry.
+func (s *KVStore) Delete(id uuid.UUID) error {
+	e, found, err := s.Get(id)
+	if err != nil || !found {
+		return err
+	}
+	if err := s.unindex(e); err != nil {
+		return err
+	}
+	if err := s.store.Delete(indexedKey(id)); err != nil {
+		return err
+	}
+	if err := s.store.Delete(executionKey(id)); err != nil {
+		return err
+	}
+	return s.store.Delete(id.String())
+}
+
+// List returns the executions selected by the query, most recent first. It
+// merges the buckets of the selected jobs, from the most recent, until it
+// has a full page.
+func (s *KVStore) List(q ExecutionQuery) ([]*Execution, string, error) {
+	cursor, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	b := bounds{since: q.Since, until: q.Until, cursor: cursor}
+
+	jobs := q.Jobs
+	if len(jobs) == 0 {
+		if jobs, err = s.readJobs(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// the jobs of each bucket
+	jobsOf := make(map[string][]string)
+	for _, jobName := range jobs {
+		buckets, err := s.readBuckets(jobName)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, bucket := range buckets {
+			jobsOf[bucket] = append(jobsOf[bucket], jobName)
+		}
+	}
+
+	buckets := make([]string, 0, len(jobsOf))
+	for bucket := range jobsOf {
+		buckets = append(buckets, bucket)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(buckets)))
+
+	executions := make([]*Execution, 0)
+	var last indexEntry
+
+	for _, bucket := range buckets {
+		if b.skipBucket(bucket) {
+			continue
+		}
+
+		entries := make([]indexEntry, 0)
+		for _, jobName := range jobsOf[bucket] {
+			bucketEntries, err := s.readBucket(jobName, bucket)
+			if err != nil {
+				return nil, "", err
+			}
+			entries = append(entries, bucketEntries...)
+		}
+		sort.SliceStable(entries, func(x, y int) bool { return entries[y].before(entries[x]) })
+
+		for _, entry := range entries {
+			if !b.matches(entry) {
+				continue
+			}
+
+			id, err := uuid.Parse(entry.ID)
+			if err != nil {
+				continue
+			}
+			e, found, err := s.Get(id)
+			if err != nil {
+				return nil, "", err
+			}
+			if !found || (q.State != "" && e.State != q.State) {
+				continue
+			}
+
+			// there is at least one more execution after this page
+			if q.Limit > 0 && len(executions) == q.Limit {
+				return executions, encodeCursor(&last), nil
+			}
+
+			executions = append(executions, e)
+			last = entry
+		}
+	}
+
+	return executions, "", nil
+}
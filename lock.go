@@ -0,0 +1,82 @@
+package goflow
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/philippgille/gokv"
+)
+
+// A StoreLocker is a Store that can hold a lock across processes, for
+// example with a lease, SET NX in Redis or an advisory lock in Postgres.
+// When the Store implements it, the KVStore locks the index of a job while
+// updating it, so that several processes can share the store. Within a
+// process the updates are always serialized.
+type StoreLocker interface {
+	// Lock blocks until the key is locked, and returns the function that
+	// unlocks it.
+	Lock(key string) (unlock func() error, err error)
+}
+
+// indexLocks serializes the updates of the index within the process,
+// whichever Goflow instance makes them.
+var indexLocks = keyedMutex{locks: make(map[string]*sync.Mutex)}
+
+// keyedMutex is a set of mutexes, one per key.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock blocks until the key is locked, and returns the function that
+// unlocks it.
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		k.locks[key] = l
+	}
+	k.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+func lockKey(name string) string {
+	return "goflow:lock:" + name
+}
+
+// lockIndex locks a part of the index, in the process and in the store if
+// it is a StoreLocker, and returns the function that unlocks it. The index
+// of a job is locked by jobLock, and the list of jobs by jobsLock.
+func lockIndex(s gokv.Store, name string) (func(), error) {
+	unlock := indexLocks.lock(name)
+
+	l, ok := s.(StoreLocker)
+	if !ok {
+		return unlock, nil
+	}
+
+	unlockStore, err := l.Lock(lockKey(name))
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("Failed to lock %s: %v", name, err)
+	}
+
+	return func() {
+		if err := unlockStore(); err != nil {
+			log.Printf("lock=%v, msg=failed to unlock, error=%v", name, err)
+		}
+		unlock()
+	}, nil
+}
+
+// jobLock is the name of the lock of a job's index.
+func jobLock(jobName string) string {
+	return "job:" + jobName
+}
+
+// jobsLock is the name of the lock of the list of jobs.
+const jobsLock = "jobs"
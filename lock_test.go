@@ -0,0 +1,132 @@
+package goflow
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/philippgille/gokv"
+	"github.com/philippgille/gokv/gomap"
+)
+
+// yieldingStore lets other goroutines run before each read, so that
+// concurrent updates interleave.
+type yieldingStore struct {
+	gokv.Store
+}
+
+func (s yieldingStore) Get(k string, v interface{}) (bool, error) {
+	runtime.Gosched()
+	return s.Store.Get(k, v)
+}
+
+// lockingStore is a StoreLocker that counts its locks, and can be made to
+// fail.
+type lockingStore struct {
+	gokv.Store
+	mu      sync.Mutex
+	locks   int
+	held    map[string]bool
+	lockErr error
+	setErr  error
+}
+
+func (s *lockingStore) Lock(key string) (func() error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lockErr != nil {
+		return nil, s.lockErr
+	}
+	if s.held == nil {
+		s.held = make(map[string]bool)
+	}
+	if s.held[key] {
+		return nil, errors.New("Lock is already held")
+	}
+	s.locks++
+	s.held[key] = true
+	return func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.held, key)
+		return nil
+	}, nil
+}
+
+func (s *lockingStore) Set(k string, v interface{}) error {
+	s.mu.Lock()
+	err := s.setErr
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.Store.Set(k, v)
+}
+
+func TestConcurrentIndexUpdates(t *testing.T) {
+	stores := []gokv.Store{
+		yieldingStore{gomap.NewStore(gomap.DefaultOptions)},
+		&lockingStore{Store: yieldingStore{gomap.NewStore(gomap.DefaultOptions)}},
+	}
+
+	for _, s := range stores {
+		es := NewKVStore(s)
+		j := &Job{Name: "concurrent"}
+		j.Add(&Task{Name: "true", Operator: Command{Cmd: "true"}})
+
+		var wg sync.WaitGroup
+		for ix := 0; ix < 50; ix++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := saveNewExecution(es, j.newExecution(nil)); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		executions, _ := readExecutions(es, "concurrent")
+		if len(executions) != 50 {
+			t.Errorf("Got %d executions in the index, expected 50", len(executions))
+		}
+	}
+
+	// the first execution also adds the job to the list of jobs
+	if locks := stores[1].(*lockingStore).locks; locks != 51 {
+		t.Errorf("Got %d store locks, expected 51", locks)
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	s := &lockingStore{Store: gomap.NewStore(gomap.DefaultOptions)}
+	j := &Job{Name: "failing"}
+	j.Add(&Task{Name: "true", Operator: Command{Cmd: "true"}})
+
+	s.lockErr = errors.New("Lock timed out")
+	err := saveNewExecution(NewKVStore(s), j.newExecution(nil))
+	if !isStoreError(err) {
+		t.Errorf("Expected a store error when the lock fails, got %v", err)
+	}
+	s.lockErr = nil
+
+	// the submit route reports a store error as a server error
+	g := New(Options{Store: s})
+	g.AddJob(func() *Job {
+		j := &Job{Name: "failing"}
+		j.Add(&Task{Name: "true", Operator: Command{Cmd: "true"}})
+		return j
+	})
+	g.addAPIRoutes()
+
+	s.setErr = errors.New("Store is down")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/jobs/failing/submit", nil)
+	g.router.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("httpStatus is %d, expected %d", w.Code, http.StatusInternalServerError)
+	}
+}
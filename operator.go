@@ -1,10 +1,13 @@
 package goflow
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os/exec"
+	"time"
 )
 
 // An Operator implements a Run() method. When a job executes a task that
@@ -13,6 +16,52 @@ type Operator interface {
 	Run() (interface{}, error)
 }
 
+// A ContextOperator is an Operator that also implements a RunContext() method.
+// When a job executes a task that uses the operator, RunContext() is called
+// instead of Run(). The context is cancelled when the task should stop, so
+// long-running work should return as soon as possible after ctx.Done() is closed.
+type ContextOperator interface {
+	Operator
+	RunContext(ctx context.Context) (interface{}, error)
+}
+
+// contextAdapter lets an operator that only implements Run() be used where
+// a ContextOperator is expected.
+type contextAdapter struct {
+	Operator
+}
+
+type operatorResult struct {
+	val interface{}
+	err error
+}
+
+// RunContext calls Run() in a separate goroutine. If the context is done first,
+// the result of Run() is abandoned and the context error is returned.
+func (o contextAdapter) RunContext(ctx context.Context) (interface{}, error) {
+	results := make(chan operatorResult, 1)
+	go func() {
+		val, err := o.Operator.Run()
+		results <- operatorResult{val, err}
+	}()
+
+	select {
+	case res := <-results:
+		return res.val, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// withContext returns the operator as a ContextOperator, wrapping it in an
+// adapter if it does not implement RunContext().
+func withContext(o Operator) ContextOperator {
+	if co, ok := o.(ContextOperator); ok {
+		return co
+	}
+	return contextAdapter{o}
+}
+
 // Command executes a shell command.
 type Command struct {
 	Cmd  string
@@ -22,8 +71,33 @@ type Command struct {
 // Run passes the command and arguments to exec.Command and captures the
 // output.
 func (o Command) Run() (interface{}, error) {
-	out, err := exec.Command(o.Cmd, o.Args...).Output()
-	return string(out), err
+	return o.RunContext(context.Background())
+}
+
+// commandWaitDelay is how long a cancelled command waits for its output to
+// be closed, by processes that escaped its process group.
+const commandWaitDelay = time.Second
+
+// RunContext passes the command and arguments to exec.CommandContext and
+// returns the output. The process and its children are killed if the
+// context is done before the command exits. Stdout, stderr and the exit
+// code are also saved with the task attempt.
+func (o Command) RunContext(ctx context.Context) (interface{}, error) {
+	stdout, stderr := TaskOutput(ctx)
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, o.Cmd, o.Args...)
+	cmd.Stdout = io.MultiWriter(&out, stdout)
+	cmd.Stderr = stderr
+	cmd.WaitDelay = commandWaitDelay
+	setProcessGroup(cmd)
+
+	err := cmd.Run()
+	if cmd.ProcessState != nil {
+		setExitCode(ctx, cmd.ProcessState.ExitCode())
+	}
+
+	return out.String(), err
 }
 
 // Get makes a GET request.
@@ -35,18 +109,17 @@ type Get struct {
 // Run sends the request and returns an error if the status code is
 // outside the 2xx range.
 func (o Get) Run() (interface{}, error) {
-	res, err := o.Client.Get(o.URL)
+	return o.RunContext(context.Background())
+}
+
+// RunContext sends the request and returns an error if the status code is
+// outside the 2xx range. The request is aborted if the context is done.
+func (o Get) RunContext(ctx context.Context) (interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.URL, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode < 200 || res.StatusCode > 299 {
-		return nil, fmt.Errorf("Received status code %v", res.StatusCode)
-	}
-
-	content, err := io.ReadAll(res.Body)
-	return string(content), err
+	return do(o.Client, req)
 }
 
 // Post makes a POST request.
@@ -59,7 +132,23 @@ type Post struct {
 // Run sends the request and returns an error if the status code is
 // outside the 2xx range.
 func (o Post) Run() (interface{}, error) {
-	res, err := o.Client.Post(o.URL, "application/json", o.Body)
+	return o.RunContext(context.Background())
+}
+
+// RunContext sends the request and returns an error if the status code is
+// outside the 2xx range. The request is aborted if the context is done.
+func (o Post) RunContext(ctx context.Context) (interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL, o.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(o.Client, req)
+}
+
+// do sends an HTTP request and reads the response body.
+func do(client *http.Client, req *http.Request) (interface{}, error) {
+	res, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -2,10 +2,12 @@ package goflow
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestCommand(t *testing.T) {
@@ -18,6 +20,15 @@ func TestCommand(t *testing.T) {
 	}
 }
 
+func TestCommandResultNotCapped(t *testing.T) {
+	result, _ := Command{Cmd: "head", Args: []string{"-c", "100000", "/dev/zero"}}.Run()
+
+	// only the logs are capped, the result is passed on as it is
+	if len(result.(string)) != 100000 {
+		t.Errorf("Got a result of %d bytes, expected %d", len(result.(string)), 100000)
+	}
+}
+
 func TestGetSuccess(t *testing.T) {
 	expected := "OK"
 	srv := httptest.NewServer(
@@ -101,3 +112,85 @@ func TestPostInvalid(t *testing.T) {
 		t.Errorf("Expected an error")
 	}
 }
+
+func TestCommandCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := Command{Cmd: "sleep", Args: []string{"10"}}.RunContext(ctx)
+
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Command was not killed when the context was done")
+	}
+}
+
+func TestCommandChildrenCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// the shell's child keeps the output open until it is killed too
+	start := time.Now()
+	_, err := Command{Cmd: "sh", Args: []string{"-c", "sleep 3; echo hi"}}.RunContext(ctx)
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Command returned after %v, expected it to be killed", elapsed)
+	}
+}
+
+func TestGetCancelled(t *testing.T) {
+	srv := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	client := &http.Client{}
+	_, err := Get{client, srv.URL}.RunContext(ctx)
+
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+}
+
+func TestContextAdapter(t *testing.T) {
+	result, err := withContext(PositiveAddition{2, 3}).RunContext(context.Background())
+
+	if err != nil || result != 5 {
+		t.Errorf("Expected 5, got %v with error %v", result, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = withContext(blockingOperator{}).RunContext(ctx)
+
+	if err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+}
+
+// PositiveAddition only implements Run().
+type PositiveAddition struct{ a, b int }
+
+func (o PositiveAddition) Run() (interface{}, error) {
+	if o.a < 0 || o.b < 0 {
+		return 0, fmt.Errorf("Can't add negative numbers")
+	}
+	return o.a + o.b, nil
+}
+
+// blockingOperator takes a very long time to return.
+type blockingOperator struct{}
+
+func (o blockingOperator) Run() (interface{}, error) {
+	time.Sleep(time.Hour)
+	return nil, nil
+}
@@ -0,0 +1,67 @@
+package goflow
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Only the last maxLogSize bytes of stdout and stderr are kept for each
+// task attempt.
+const maxLogSize = 16 * 1024
+
+// cappedBuffer is an io.Writer that keeps the tail of what is written to it.
+type cappedBuffer struct {
+	buf       []byte
+	truncated bool
+	mu        sync.Mutex
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > maxLogSize {
+		b.buf = b.buf[len(b.buf)-maxLogSize:]
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.truncated {
+		return "[truncated]\n" + string(b.buf)
+	}
+	return string(b.buf)
+}
+
+// taskOutput collects the output of an operator during a task attempt.
+type taskOutput struct {
+	stdout   cappedBuffer
+	stderr   cappedBuffer
+	exitCode *int
+}
+
+// TaskOutput returns writers for the stdout and stderr of the task being run.
+// What an operator writes to them is saved with the task attempt and can be
+// read from the logs endpoint. It is meant to be called from the RunContext()
+// method of a ContextOperator. Outside of a task, the writers discard
+// everything.
+func TaskOutput(ctx context.Context) (stdout, stderr io.Writer) {
+	out, ok := ctx.Value(taskOutputKey).(*taskOutput)
+	if !ok {
+		return io.Discard, io.Discard
+	}
+	return &out.stdout, &out.stderr
+}
+
+// setExitCode records the exit code of a process run by an operator.
+func setExitCode(ctx context.Context, code int) {
+	if out, ok := ctx.Value(taskOutputKey).(*taskOutput); ok {
+		out.exitCode = &code
+	}
+}
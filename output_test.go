@@ -0,0 +1,37 @@
+package goflow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCappedBuffer(t *testing.T) {
+	b := &cappedBuffer{}
+	fmt.Fprint(b, "hello")
+
+	if b.String() != "hello" {
+		t.Errorf("Got %q, expected %q", b.String(), "hello")
+	}
+
+	fmt.Fprint(b, strings.Repeat("x", maxLogSize))
+
+	if !strings.HasPrefix(b.String(), "[truncated]\n") {
+		t.Errorf("Expected the output to be marked as truncated")
+	}
+	if strings.Contains(b.String(), "hello") {
+		t.Errorf("Expected the start of the output to be dropped")
+	}
+}
+
+func TestTaskOutputOutsideTask(t *testing.T) {
+	stdout, stderr := TaskOutput(context.Background())
+
+	if _, err := fmt.Fprint(stdout, "discarded"); err != nil {
+		t.Errorf("Got error %v", err)
+	}
+	if _, err := fmt.Fprint(stderr, "discarded"); err != nil {
+		t.Errorf("Got error %v", err)
+	}
+}
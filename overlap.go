@@ -0,0 +1,235 @@
+package goflow
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// An OverlapPolicy decides what happens when a job is triggered while it
+// already has MaxActiveRuns executions running.
+type OverlapPolicy string
+
+const (
+	// OverlapSkip records the new execution as skipped, without running
+	// it. This is the default.
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapQueue runs the new execution once one of the active
+	// executions finishes.
+	OverlapQueue OverlapPolicy = "queue"
+	// OverlapCancel cancels the oldest active execution and runs the new
+	// one right away.
+	OverlapCancel OverlapPolicy = "cancel"
+)
+
+// valid returns false if the overlap policy is unknown.
+func (p OverlapPolicy) valid() bool {
+	switch p {
+	case "", OverlapSkip, OverlapQueue, OverlapCancel:
+		return true
+	}
+	return false
+}
+
+var errSkipped = errors.New("Job has reached its maximum number of active runs")
+
+// runningExecution is an execution tracked by the engine. done, if set,
+// is called once the execution has finished.
+type runningExecution struct {
+	jobName string
+	cancel  context.CancelFunc
+	seq     int
+	stopped bool
+	done    func()
+}
+
+// queuedExecution is an execution waiting for one of the active
+// executions of its job to finish.
+type queuedExecution struct {
+	job  *Job
+	e    *Execution
+	ctx  context.Context
+	done func()
+}
+
+// admission is the outcome of starting an execution.
+type admission int
+
+const (
+	admitRun admission = iota
+	admitQueue
+	admitSkip
+	admitRefuse
+)
+
+// submit persists a new execution of a job and starts it.
+func (g *Goflow) submit(j *Job, e *Execution) error {
+	if g.isClosing() {
+		return errShuttingDown
+	}
+
+	// the execution is persisted before it can start running
+	if err := saveNewExecution(g.Executions, e); err != nil {
+		log.Printf("jobID=%v, job=%v, msg=not submitted, error=%v", e.ID, j.Name, err)
+		return err
+	}
+
+	return g.startNew(j, e, nil)
+}
+
+// startNew starts a persisted new execution of a job. An execution that
+// is skipped or refused is recorded with a final state.
+func (g *Goflow) startNew(j *Job, e *Execution, done func()) error {
+	err := g.start(j, e, done, nil)
+	switch err {
+	case errShuttingDown:
+		finishUnstarted(g, e, StateCancelled, errShuttingDown.Error())
+	case errSkipped:
+		finishUnstarted(g, e, StateSkipped, errSkipped.Error())
+	}
+	return err
+}
+
+// start runs an execution of a job in a new goroutine, unless the job
+// already has MaxActiveRuns executions running. In that case the job's
+// overlap policy applies. prepare, if not nil, is called once the
+// execution is admitted, before it can start running, for example to
+// persist it. done, if not nil, is called once the execution has
+// finished, or right away if it isn't admitted. start returns errSkipped
+// if the execution was skipped and errShuttingDown if it was refused,
+// without changing it.
+func (g *Goflow) start(j *Job, e *Execution, done func(), prepare func()) error {
+	g.mu.Lock()
+	if _, ok := g.running[e.ID]; ok {
+		g.mu.Unlock()
+		return errRunning
+	}
+	decision, ctx := g.admit(j, e, done)
+	if prepare != nil && (decision == admitRun || decision == admitQueue) {
+		// a queued execution can't be dequeued until the lock is released
+		prepare()
+	}
+	g.mu.Unlock()
+
+	var err error
+	switch decision {
+	case admitRun:
+		go g.runExecution(ctx, j, e)
+		return nil
+	case admitQueue:
+		log.Printf("jobID=%v, job=%v, msg=queued", e.ID, j.Name)
+		return nil
+	case admitRefuse:
+		err = errShuttingDown
+	case admitSkip:
+		log.Printf("jobID=%v, job=%v, msg=skipped, error=%v", e.ID, j.Name, errSkipped)
+		err = errSkipped
+	}
+
+	if done != nil {
+		done()
+	}
+	return err
+}
+
+// admit applies the job's MaxActiveRuns and overlap policy to an
+// execution. It must be called with g.mu held.
+func (g *Goflow) admit(j *Job, e *Execution, done func()) (admission, context.Context) {
+	if g.closing {
+		return admitRefuse, nil
+	}
+
+	active := g.activeRuns(j.Name)
+	if j.MaxActiveRuns <= 0 || len(active) < j.MaxActiveRuns {
+		return admitRun, g.trackLocked(e, done)
+	}
+
+	switch j.Overlap {
+	case OverlapQueue:
+		g.queued[j.Name] = append(g.queued[j.Name], queuedExecution{job: j, e: e, done: done})
+		return admitQueue, nil
+	case OverlapCancel:
+		// executions that are already stopping don't need cancelling again
+		stopping := make([]*runningExecution, 0)
+		for _, r := range active {
+			if !r.stopped {
+				stopping = append(stopping, r)
+			}
+		}
+		for ix := 0; ix < len(stopping)-j.MaxActiveRuns+1; ix++ {
+			stopping[ix].stopped = true
+			stopping[ix].cancel()
+		}
+		return admitRun, g.trackLocked(e, done)
+	}
+
+	return admitSkip, nil
+}
+
+// activeRuns returns the running executions of a job, oldest first. It
+// must be called with g.mu held.
+func (g *Goflow) activeRuns(jobName string) []*runningExecution {
+	active := make([]*runningExecution, 0)
+	for _, r := range g.running {
+		if r.jobName == jobName {
+			active = append(active, r)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].seq < active[j].seq })
+	return active
+}
+
+// dequeue starts tracking the next queued execution of a job, if the job
+// has room for it. It must be called with g.mu held.
+func (g *Goflow) dequeue(jobName string) *queuedExecution {
+	queue := g.queued[jobName]
+	if len(queue) == 0 || g.closing {
+		return nil
+	}
+
+	next := queue[0]
+	if next.job.MaxActiveRuns > 0 && len(g.activeRuns(jobName)) >= next.job.MaxActiveRuns {
+		return nil
+	}
+
+	g.queued[jobName] = queue[1:]
+	next.ctx = g.trackLocked(next.e, next.done)
+	return &next
+}
+
+// unqueue removes an execution from the queue of its job. It returns
+// false if the execution is not queued.
+func (g *Goflow) unqueue(id uuid.UUID) (queuedExecution, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for jobName, queue := range g.queued {
+		for ix, q := range queue {
+			if q.e.ID == id {
+				g.queued[jobName] = append(queue[:ix:ix], queue[ix+1:]...)
+				return q, true
+			}
+		}
+	}
+	return queuedExecution{}, false
+}
+
+// finishUnstarted gives the unfinished tasks of an execution that wasn't
+// run a final state, and persists it. The tasks that already finished in
+// an earlier run keep their state.
+func finishUnstarted(g *Goflow, e *Execution, value State, err string) {
+	for ix, task := range e.TaskExecutions {
+		if task.State.finished() {
+			continue
+		}
+		e.TaskExecutions[ix].State = value
+		e.TaskExecutions[ix].Error = err
+	}
+	e.State = value
+	if err := persistExecution(g.Executions, e); err != nil {
+		log.Printf("jobID=%v, job=%v, error=%v", e.ID, e.JobName, err)
+	}
+}
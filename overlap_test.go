@@ -0,0 +1,169 @@
+package goflow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func overlappingJob(policy OverlapPolicy) func() *Job {
+	return func() *Job {
+		j := &Job{Name: "overlap-" + string(policy), Schedule: "* * * * *", MaxActiveRuns: 1, Overlap: policy}
+		j.Add(&Task{Name: "sleep", Operator: Command{Cmd: "sleep", Args: []string{"0.3"}}})
+		return j
+	}
+}
+
+func submitTwice(t *testing.T, policy OverlapPolicy) (*Goflow, *Execution, *Execution, error) {
+	g := New(Options{})
+	if err := g.AddJob(overlappingJob(policy)); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := g.execute("overlap-"+string(policy), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := g.execute("overlap-"+string(policy), nil)
+
+	g.wg.Wait()
+	e1, _, _ := g.Executions.Get(first)
+	e2, _, _ := g.Executions.Get(second)
+	return g, e1, e2, err
+}
+
+func TestOverlapSkip(t *testing.T) {
+	_, e1, e2, err := submitTwice(t, OverlapSkip)
+
+	if err != errSkipped {
+		t.Errorf("Got error %v, expected %v", err, errSkipped)
+	}
+	if e1.State != StateSuccessful || e2.State != StateSkipped {
+		t.Errorf("Got states %v and %v, expected %v and %v", e1.State, e2.State, StateSuccessful, StateSkipped)
+	}
+}
+
+func TestOverlapQueue(t *testing.T) {
+	_, e1, e2, err := submitTwice(t, OverlapQueue)
+
+	if err != nil {
+		t.Errorf("Got error %v, expected none", err)
+	}
+	if e1.State != StateSuccessful || e2.State != StateSuccessful {
+		t.Fatalf("Got states %v and %v, expected %v", e1.State, e2.State, StateSuccessful)
+	}
+
+	ended, _ := time.Parse(time.RFC3339Nano, e1.TaskExecutions[0].Attempts[0].EndedAt)
+	started, _ := time.Parse(time.RFC3339Nano, e2.TaskExecutions[0].Attempts[0].StartedAt)
+	if started.Before(ended) {
+		t.Errorf("Expected the queued execution to start after the first one ended")
+	}
+}
+
+func TestOverlapCancel(t *testing.T) {
+	_, e1, e2, err := submitTwice(t, OverlapCancel)
+
+	if err != nil {
+		t.Errorf("Got error %v, expected none", err)
+	}
+	if e1.State != StateCancelled || e2.State != StateSuccessful {
+		t.Errorf("Got states %v and %v, expected %v and %v", e1.State, e2.State, StateCancelled, StateSuccessful)
+	}
+}
+
+func TestCancelQueuedExecution(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(overlappingJob(OverlapQueue))
+
+	g.execute("overlap-queue", nil)
+	second, _ := g.execute("overlap-queue", nil)
+
+	if !g.cancel(second) {
+		t.Errorf("Expected the queued execution to be cancelled")
+	}
+	g.wg.Wait()
+
+	e, _, _ := g.Executions.Get(second)
+	if e.State != StateCancelled || len(e.TaskExecutions[0].Attempts) != 0 {
+		t.Errorf("Got state %v, expected %v without attempts", e.State, StateCancelled)
+	}
+}
+
+func TestRerunOverlap(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(overlappingJob(OverlapSkip))
+
+	first, _ := g.execute("overlap-skip", nil)
+	g.wg.Wait()
+	g.execute("overlap-skip", nil)
+
+	// the rerun counts against MaxActiveRuns like a new execution, and
+	// the stored execution is left as it was
+	e, _, _ := g.Executions.Get(first)
+	if err := g.rerun(e, []string{"sleep"}); err != errSkipped {
+		t.Errorf("Got error %v, expected %v", err, errSkipped)
+	}
+	g.wg.Wait()
+
+	stored, _, _ := g.Executions.Get(first)
+	if stored.State != StateSuccessful || stored.TaskExecutions[0].State != StateSuccessful || stored.TaskExecutions[0].Error != "" {
+		t.Errorf("Got %+v, expected the execution not to be changed", stored)
+	}
+}
+
+func TestBackfillOverlap(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(overlappingJob(OverlapQueue))
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ids, err := g.backfill("overlap-queue", start, start.Add(3*time.Minute), 3)
+	if err != nil || len(ids) != 3 {
+		t.Fatalf("Got %d executions with error %v, expected 3", len(ids), err)
+	}
+
+	executions := make([]*Execution, 0)
+	for _, id := range ids {
+		var e *Execution
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			if e, _, _ = g.Executions.Get(id); e.State.finished() {
+				break
+			}
+		}
+		executions = append(executions, e)
+	}
+	g.wg.Wait()
+
+	// the backfilled executions are queued behind each other
+	for ix := 1; ix < len(executions); ix++ {
+		ended, _ := time.Parse(time.RFC3339Nano, executions[ix-1].TaskExecutions[0].Attempts[0].EndedAt)
+		started, _ := time.Parse(time.RFC3339Nano, executions[ix].TaskExecutions[0].Attempts[0].StartedAt)
+		if started.Before(ended) {
+			t.Errorf("Expected backfilled execution %d to start after the previous one ended", ix)
+		}
+	}
+}
+
+func TestSubmitSkippedRoute(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(overlappingJob(OverlapSkip))
+	g.addAPIRoutes()
+
+	codes := make([]int, 0)
+	for ix := 0; ix < 2; ix++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/jobs/overlap-skip/submit", nil)
+		g.router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	g.wg.Wait()
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusConflict {
+		t.Errorf("Got httpStatus %v, expected [%d %d]", codes, http.StatusOK, http.StatusConflict)
+	}
+
+	executions, _ := readExecutions(g.Executions, "overlap-skip")
+	if len(executions) != 2 {
+		t.Errorf("Got %d executions, expected the skipped one to be recorded", len(executions))
+	}
+}
@@ -0,0 +1,140 @@
+package goflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ParamType is the type of a job parameter.
+type ParamType string
+
+// Params can be strings, numbers or booleans, as decoded from JSON.
+const (
+	StringParam ParamType = "string"
+	NumberParam ParamType = "number"
+	BoolParam   ParamType = "boolean"
+)
+
+// A Param declares a runtime parameter of a job. Values for the params are
+// passed when the job is submitted, and are stored with the execution.
+// Required params must be passed on every submission. Other params take
+// their Default value when they are left out.
+type Param struct {
+	Type        ParamType   `json:"type"`
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+// check returns an error if the value doesn't match the param type.
+func (p Param) check(name string, value interface{}) error {
+	ok := false
+	switch p.Type {
+	case StringParam:
+		_, ok = value.(string)
+	case NumberParam:
+		switch value.(type) {
+		case float64, float32, int, int32, int64:
+			ok = true
+		}
+	case BoolParam:
+		_, ok = value.(bool)
+	default:
+		return fmt.Errorf("Invalid type %q for param %s", p.Type, name)
+	}
+	if !ok {
+		return fmt.Errorf("Param %s must be a %s, got %v", name, p.Type, value)
+	}
+	return nil
+}
+
+// validateParams checks the param declarations of a job.
+func (j *Job) validateParams() []error {
+	errs := make([]error, 0)
+	if j.Active {
+		if err := j.checkActivation(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, name := range sortedParams(j.Params) {
+		p := j.Params[name]
+		if p.Type != StringParam && p.Type != NumberParam && p.Type != BoolParam {
+			errs = append(errs, fmt.Errorf("Invalid type %q for param %s in job %s", p.Type, name, j.Name))
+			continue
+		}
+		if p.Default != nil {
+			if err := p.check(name, p.Default); err != nil {
+				errs = append(errs, fmt.Errorf("Invalid default for param %s in job %s: %v", name, j.Name, err))
+			}
+		}
+	}
+	return errs
+}
+
+// checkActivation returns an error if the schedule of the job can't be
+// active, because its scheduled runs only use the defaults and it has
+// required params.
+func (j *Job) checkActivation() error {
+	for _, name := range sortedParams(j.Params) {
+		if j.Params[name].Required {
+			return fmt.Errorf("Job %s can't be active because param %s is required, and scheduled runs only use defaults", j.Name, name)
+		}
+	}
+	return nil
+}
+
+// resolveParams checks submitted values against the params declared on
+// the job and fills in the defaults. It returns an error for unknown
+// params, missing required params and values of the wrong type.
+func (j *Job) resolveParams(values map[string]interface{}) (map[string]interface{}, error) {
+	errs := make([]error, 0)
+	resolved := make(map[string]interface{})
+
+	for _, name := range sortedParams(values) {
+		if _, ok := j.Params[name]; !ok {
+			errs = append(errs, fmt.Errorf("Unknown param %s for job %s", name, j.Name))
+		}
+	}
+
+	for _, name := range sortedParams(j.Params) {
+		p := j.Params[name]
+		value, ok := values[name]
+		switch {
+		case ok && value != nil:
+			if err := p.check(name, value); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			resolved[name] = value
+		case p.Required:
+			errs = append(errs, fmt.Errorf("Missing required param %s for job %s", name, j.Name))
+		case p.Default != nil:
+			resolved[name] = p.Default
+		}
+	}
+
+	return resolved, errors.Join(errs...)
+}
+
+func sortedParams[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Params returns the runtime parameters of the execution that the task
+// being run belongs to. It is meant to be called from the RunContext()
+// method of a ContextOperator. With the default JSON codec, numbers of an
+// execution resumed from the store are float64.
+func Params(ctx context.Context) map[string]interface{} {
+	params, ok := ctx.Value(paramsKey).(map[string]interface{})
+	if !ok {
+		return make(map[string]interface{})
+	}
+	return params
+}
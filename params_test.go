@@ -0,0 +1,83 @@
+package goflow
+
+import (
+	"testing"
+
+	"github.com/philippgille/gokv/gomap"
+)
+
+func paramsJob() *Job {
+	j := &Job{Name: "params", Schedule: "* * * * *", Params: map[string]Param{
+		"date":   {Type: StringParam, Required: true},
+		"limit":  {Type: NumberParam, Default: float64(10)},
+		"dryRun": {Type: BoolParam},
+	}}
+	j.Add(&Task{Name: "echo", Templated: true, Operator: Command{Cmd: "echo", Args: []string{"{{.Params.date}}", "{{.Params.limit}}"}}})
+	return j
+}
+
+func TestResolveParams(t *testing.T) {
+	j := paramsJob()
+
+	params, err := j.resolveParams(map[string]interface{}{"date": "2024-01-01"})
+	if err != nil {
+		t.Fatalf("Got error %v, expected none", err)
+	}
+	if params["date"] != "2024-01-01" || params["limit"] != float64(10) {
+		t.Errorf("Got params %v", params)
+	}
+	if _, ok := params["dryRun"]; ok {
+		t.Errorf("Expected a param without a value or default to be left out")
+	}
+
+	invalid := []map[string]interface{}{
+		nil,
+		{"date": 20240101},
+		{"date": "2024-01-01", "dryRun": "yes"},
+		{"date": "2024-01-01", "other": true},
+	}
+	for _, values := range invalid {
+		if _, err := j.resolveParams(values); err == nil {
+			t.Errorf("Expected an error for params %v", values)
+		}
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	j := paramsJob()
+	j.Params["bad"] = Param{Type: "date"}
+	j.Params["badDefault"] = Param{Type: NumberParam, Default: "ten"}
+
+	if err := j.Validate(); err == nil {
+		t.Errorf("Expected invalid params to be reported")
+	}
+
+	// the scheduled runs of an active job would never start
+	j = paramsJob()
+	if err := j.Validate(); err != nil {
+		t.Errorf("Got error %v, expected none", err)
+	}
+	j.Active = true
+	if err := j.Validate(); err == nil {
+		t.Errorf("Expected a required param of an active job to be reported")
+	}
+}
+
+func TestActivateRequiredParams(t *testing.T) {
+	store := gomap.NewStore(gomap.DefaultOptions)
+	g := New(Options{Store: store})
+	if err := g.AddJob(paramsJob); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := g.toggle("params"); err == nil || isScheduled(g, "params") {
+		t.Errorf("Expected the schedule of a job with required params not to be turned on")
+	}
+
+	// a schedule turned on before the param was required
+	g.persistSchedule("params", true)
+	g = New(Options{Store: store})
+	if err := g.AddJob(paramsJob); err == nil {
+		t.Errorf("Expected a job with required params and an active schedule to be rejected")
+	}
+}
@@ -0,0 +1,106 @@
+package goflow
+
+import (
+	"sort"
+	"sync"
+)
+
+// taskSlots limits the number of tasks running at the same time, across
+// all executions: in total, with Options.MaxRunningTasks, and per pool,
+// with Options.Pools. Waiting tasks get their slots by effective priority,
+// and in the order they asked for them when their priorities are equal.
+type taskSlots struct {
+	max     int
+	pools   map[string]int
+	running int
+	used    map[string]int
+	waiting []*slotRequest
+	mu      sync.Mutex
+}
+
+// A slotRequest is a task waiting for a slot. The granted channel is
+// closed once the task has its slot.
+type slotRequest struct {
+	pool     string
+	priority int
+	granted  chan struct{}
+}
+
+func newTaskSlots(max int, pools map[string]int) *taskSlots {
+	return &taskSlots{
+		max:   max,
+		pools: pools,
+		used:  make(map[string]int),
+	}
+}
+
+// request asks for a slot in a pool. The empty pool has no limit of its
+// own. The slot is granted right away if it is available and no task
+// with a higher priority is waiting for it.
+func (s *taskSlots) request(pool string, priority int) *slotRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &slotRequest{pool: pool, priority: priority, granted: make(chan struct{})}
+
+	// keep the waiting tasks sorted by priority, first come first served
+	ix := sort.Search(len(s.waiting), func(i int) bool { return s.waiting[i].priority < priority })
+	s.waiting = append(s.waiting, nil)
+	copy(s.waiting[ix+1:], s.waiting[ix:])
+	s.waiting[ix] = r
+
+	s.grant()
+	return r
+}
+
+// withdraw removes a request that is still waiting. It returns false if
+// the slot was already granted, in which case it must be released.
+func (s *taskSlots) withdraw(r *slotRequest) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ix, w := range s.waiting {
+		if w == r {
+			s.waiting = append(s.waiting[:ix:ix], s.waiting[ix+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// release frees a slot in a pool and grants it to the next waiting tasks.
+func (s *taskSlots) release(pool string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running--
+	s.used[pool]--
+	s.grant()
+}
+
+// grant gives the free slots to the waiting tasks, in order. A task
+// waiting for a full pool doesn't hold back tasks of other pools. It must
+// be called with s.mu held.
+func (s *taskSlots) grant() {
+	waiting := s.waiting[:0]
+	for _, r := range s.waiting {
+		if s.available(r.pool) {
+			s.running++
+			s.used[r.pool]++
+			close(r.granted)
+		} else {
+			waiting = append(waiting, r)
+		}
+	}
+	s.waiting = waiting
+}
+
+// available returns true if a task of the pool can start. It must be
+// called with s.mu held.
+func (s *taskSlots) available(pool string) bool {
+	if s.max > 0 && s.running >= s.max {
+		return false
+	}
+	size, ok := s.pools[pool]
+	return pool == "" || !ok || s.used[pool] < size
+}
@@ -0,0 +1,187 @@
+package goflow
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func isGranted(r *slotRequest) bool {
+	select {
+	case <-r.granted:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestTaskSlots(t *testing.T) {
+	s := newTaskSlots(2, map[string]int{"db": 1})
+
+	db1 := s.request("db", 0)
+	db2 := s.request("db", 0)
+	other := s.request("", 0)
+	last := s.request("", 0)
+
+	if !isGranted(db1) || isGranted(db2) || !isGranted(other) || isGranted(last) {
+		t.Fatalf("Expected only the first db task and the first other task to get a slot")
+	}
+
+	// a task waiting for a full pool doesn't hold back the others
+	s.release("")
+	if isGranted(db2) || !isGranted(last) {
+		t.Errorf("Expected the free slot to go to the task without a pool")
+	}
+
+	if !s.withdraw(db2) {
+		t.Errorf("Expected a waiting request to be withdrawn")
+	}
+	s.release("db")
+	if isGranted(db2) {
+		t.Errorf("Expected a withdrawn request not to get a slot")
+	}
+	if s.withdraw(db1) {
+		t.Errorf("Expected a granted request not to be withdrawn")
+	}
+}
+
+func TestPoolLimitsRunningTasks(t *testing.T) {
+	g := New(Options{Pools: map[string]int{"db": 1}})
+	err := g.AddJob(func() *Job {
+		j := &Job{Name: "fan-out", Schedule: "* * * * *"}
+		for _, name := range []string{"a", "b", "c"} {
+			j.Add(&Task{Name: name, Pool: "db", Operator: Command{Cmd: "sleep", Args: []string{"0.1"}}})
+		}
+		return j
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, _ := g.execute("fan-out", nil)
+	g.wg.Wait()
+
+	e, _, _ := g.Executions.Get(id)
+	if e.State != StateSuccessful {
+		t.Fatalf("Got status %v, expected %v", e.State, StateSuccessful)
+	}
+
+	attempts := make([]TaskAttempt, 0)
+	for _, task := range e.TaskExecutions {
+		attempts = append(attempts, task.Attempts...)
+	}
+	sort.Slice(attempts, func(i, j int) bool { return attempts[i].StartedAt < attempts[j].StartedAt })
+	for ix := 1; ix < len(attempts); ix++ {
+		ended, _ := time.Parse(time.RFC3339Nano, attempts[ix-1].EndedAt)
+		started, _ := time.Parse(time.RFC3339Nano, attempts[ix].StartedAt)
+		if started.Before(ended) {
+			t.Errorf("Expected the tasks of the pool to run one at a time")
+		}
+	}
+}
+
+func TestPoolFanIn(t *testing.T) {
+	g := New(Options{Pools: map[string]int{"db": 1}})
+	g.AddJob(func() *Job {
+		j := &Job{Name: "fan-in", Schedule: "* * * * *"}
+		j.Add(&Task{Name: "a", Pool: "db", Operator: Command{Cmd: "sleep", Args: []string{"0.1"}}})
+		j.Add(&Task{Name: "b", Pool: "db", Operator: Command{Cmd: "sleep", Args: []string{"0.1"}}})
+		j.Add(&Task{Name: "c", Operator: Command{Cmd: "true"}})
+		j.SetDownstream(j.Task("a"), j.Task("c"))
+		j.SetDownstream(j.Task("b"), j.Task("c"))
+		return j
+	})
+
+	id, _ := g.execute("fan-in", nil)
+	g.wg.Wait()
+
+	// the task downstream waits for the task queued for the pool
+	e, _, _ := g.Executions.Get(id)
+	for _, task := range e.TaskExecutions {
+		if task.State != StateSuccessful {
+			t.Errorf("Got state %v for task %s, expected %v", task.State, task.Name, StateSuccessful)
+		}
+	}
+}
+
+func TestUnknownPool(t *testing.T) {
+	g := New(Options{})
+	err := g.AddJob(func() *Job {
+		j := &Job{Name: "unknown-pool", Schedule: "* * * * *"}
+		j.Add(&Task{Name: "a", Pool: "db", Operator: Command{Cmd: "true"}})
+		return j
+	})
+	if err == nil {
+		t.Errorf("Expected an error for an unknown pool")
+	}
+}
+
+func TestInvalidPoolSize(t *testing.T) {
+	jobFn := func() *Job {
+		j := &Job{Name: "empty-pool", Schedule: "* * * * *"}
+		j.Add(&Task{Name: "a", Pool: "db", Operator: Command{Cmd: "true"}})
+		return j
+	}
+
+	for _, size := range []int{0, -1} {
+		g := New(Options{Pools: map[string]int{"db": size}})
+		if err := g.AddJob(jobFn); err == nil {
+			t.Errorf("Expected an error for a pool of size %d", size)
+		}
+	}
+
+	g := New(Options{MaxRunningTasks: -1, Pools: map[string]int{"db": 1}})
+	if err := g.AddJob(jobFn); err == nil {
+		t.Errorf("Expected an error for a negative MaxRunningTasks")
+	}
+}
+
+func TestTaskSlotsPriority(t *testing.T) {
+	s := newTaskSlots(1, nil)
+
+	first := s.request("", 0)
+	low := s.request("", 0)
+	high := s.request("", 5)
+	mid := s.request("", 1)
+	alsoHigh := s.request("", 5)
+
+	order := []*slotRequest{first, high, alsoHigh, mid, low}
+	for ix, r := range order {
+		for jx, other := range order[ix:] {
+			if isGranted(other) != (jx == 0) {
+				t.Fatalf("Expected request %d alone to have the slot", ix)
+			}
+		}
+		s.release("")
+		<-r.granted
+	}
+}
+
+func TestWeightRule(t *testing.T) {
+	j := &Job{Name: "weights", Schedule: "* * * * *"}
+	j.Add(&Task{Name: "extract", Operator: Command{Cmd: "true"}, Priority: 1})
+	j.Add(&Task{Name: "transform", Operator: Command{Cmd: "true"}})
+	j.Add(&Task{Name: "load", Operator: Command{Cmd: "true"}})
+	j.SetDownstream(j.Task("extract"), j.Task("transform"))
+	j.SetDownstream(j.Task("transform"), j.Task("load"))
+
+	cases := map[WeightRule][]int{
+		"":               {1, 0, 0},
+		WeightAbsolute:   {1, 0, 0},
+		WeightDownstream: {3, 1, 0},
+		WeightUpstream:   {1, 1, 2},
+	}
+	for rule, expected := range cases {
+		j.WeightRule = rule
+		for ix, name := range []string{"extract", "transform", "load"} {
+			if w := j.weight(j.Task(name)); w != expected[ix] {
+				t.Errorf("Got weight %d for %s with rule %q, expected %d", w, name, rule, expected[ix])
+			}
+		}
+	}
+
+	j.WeightRule = "heaviest"
+	if err := j.Validate(); err == nil {
+		t.Errorf("Expected an error for an unknown weight rule")
+	}
+}
@@ -0,0 +1,127 @@
+package goflow
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// A RecoveryPolicy decides what happens at startup to the executions that
+// were still unfinished in the store, because the previous process stopped
+// while they were running.
+type RecoveryPolicy string
+
+const (
+	// RecoverFail marks the unfinished tasks of an orphaned execution as
+	// failed. This is the default.
+	RecoverFail RecoveryPolicy = "fail"
+	// RecoverResume runs the unfinished tasks of an orphaned execution
+	// again, keeping the tasks that had already finished.
+	RecoverResume RecoveryPolicy = "resume"
+)
+
+const (
+	errInterrupted = "Goflow stopped while the task was running"
+	errOrphaned    = "Goflow stopped before the task finished"
+)
+
+// unfinishedStates are the states of the executions left unfinished when
+// Goflow stopped.
+var unfinishedStates = []State{StateNotStarted, StateRunning}
+
+// unfinishedExecutions returns the unfinished executions of a job, oldest
+// first.
+func unfinishedExecutions(s ExecutionStore, jobName string) ([]*Execution, error) {
+	executions := make([]*Execution, 0)
+	for _, state := range unfinishedStates {
+		q := ExecutionQuery{Jobs: []string{jobName}, State: state}
+		err := eachExecution(s, q, func(e *Execution) bool {
+			executions = append(executions, e)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(executions, func(a, b int) bool {
+		ta, _ := time.Parse(time.RFC3339Nano, executions[a].StartedAt)
+		tb, _ := time.Parse(time.RFC3339Nano, executions[b].StartedAt)
+		return ta.Before(tb)
+	})
+	return executions, nil
+}
+
+// recoverExecutions looks for executions of the registered jobs that were
+// left unfinished in the store, and fails or resumes them according to the
+// recovery policy.
+func (g *Goflow) recoverExecutions() {
+	for _, jobName := range g.jobs {
+		executions, err := unfinishedExecutions(g.Executions, jobName)
+		if err != nil {
+			log.Printf("job=%v, msg=recovery failed, error=%v", jobName, err)
+			continue
+		}
+
+		for _, e := range executions {
+			interruptAttempts(e)
+
+			if g.Options.Recovery == RecoverResume {
+				g.resume(e)
+			} else {
+				failOrphan(e)
+				if err := persistExecution(g.Executions, e); err != nil {
+					log.Printf("jobID=%v, job=%v, msg=recovery failed, error=%v", e.ID, e.JobName, err)
+				}
+			}
+		}
+	}
+}
+
+// resume continues running an execution in a new goroutine, subject to
+// the job's MaxActiveRuns and overlap policy. An execution that can't be
+// resumed is failed like with RecoverFail.
+func (g *Goflow) resume(e *Execution) {
+	j := g.Jobs[e.JobName]()
+	j.restore(e)
+
+	err := g.start(j, e, nil, func() {
+		log.Printf("jobID=%v, job=%v, msg=resuming", e.ID, e.JobName)
+		if err := persistExecution(g.Executions, e); err != nil {
+			log.Printf("jobID=%v, job=%v, error=%v", e.ID, e.JobName, err)
+		}
+	})
+	if err == nil {
+		return
+	}
+
+	log.Printf("jobID=%v, job=%v, msg=not resumed, error=%v", e.ID, e.JobName, err)
+	failOrphan(e)
+	if err := persistExecution(g.Executions, e); err != nil {
+		log.Printf("jobID=%v, job=%v, msg=recovery failed, error=%v", e.ID, e.JobName, err)
+	}
+}
+
+// interruptAttempts marks the task attempts that were running as failed.
+func interruptAttempts(e *Execution) {
+	for ix := range e.TaskExecutions {
+		for jx, a := range e.TaskExecutions[ix].Attempts {
+			if !a.State.finished() && a.State != StateUpForRetry {
+				e.TaskExecutions[ix].Attempts[jx].State = StateFailed
+				e.TaskExecutions[ix].Attempts[jx].Error = errInterrupted
+			}
+		}
+	}
+}
+
+// failOrphan marks the unfinished tasks of an execution as failed.
+func failOrphan(e *Execution) {
+	for ix, task := range e.TaskExecutions {
+		if !task.State.finished() {
+			e.TaskExecutions[ix].State = StateFailed
+			e.TaskExecutions[ix].Error = errOrphaned
+		}
+	}
+	e.State = StateFailed
+	log.Printf("jobID=%v, job=%v, msg=%v, error=%v", e.ID, e.JobName, e.State, errOrphaned)
+}
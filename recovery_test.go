@@ -0,0 +1,95 @@
+package goflow
+
+import (
+	"testing"
+)
+
+func twoStepJob() *Job {
+	j := &Job{Name: "two-step", Schedule: "* * * * *"}
+	j.Add(&Task{Name: "first", Operator: Command{Cmd: "true"}})
+	j.Add(&Task{Name: "second", Operator: Command{Cmd: "true"}})
+	j.SetDownstream(j.Task("first"), j.Task("second"))
+	return j
+}
+
+// orphan persists an execution of twoStepJob that was interrupted while
+// its second task was running.
+func orphan(g *Goflow) *Execution {
+	e := twoStepJob().newExecution(nil)
+	e.State = StateRunning
+	e.TaskExecutions[0].State = StateSuccessful
+	e.TaskExecutions[0].Attempts = []TaskAttempt{{Attempt: 1, State: StateSuccessful}}
+	e.TaskExecutions[1].State = StateRunning
+	e.TaskExecutions[1].Attempts = []TaskAttempt{{Attempt: 1, State: StateRunning}}
+	saveNewExecution(g.Executions, e)
+	return e
+}
+
+func TestRecoverFail(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(twoStepJob)
+	e := orphan(g)
+
+	g.recoverExecutions()
+
+	recovered, _, _ := g.Executions.Get(e.ID)
+	if recovered.State != StateFailed {
+		t.Errorf("Got status %v, expected %v", recovered.State, StateFailed)
+	}
+	if recovered.TaskExecutions[0].State != StateSuccessful {
+		t.Errorf("Got status %v, expected %v", recovered.TaskExecutions[0].State, StateSuccessful)
+	}
+	if task := recovered.TaskExecutions[1]; task.State != StateFailed || task.Error != errOrphaned {
+		t.Errorf("Got status %v with error %q, expected %v", task.State, task.Error, StateFailed)
+	}
+	if a := recovered.TaskExecutions[1].Attempts[0]; a.State != StateFailed || a.Error != errInterrupted {
+		t.Errorf("Got attempt status %v with error %q, expected %v", a.State, a.Error, StateFailed)
+	}
+}
+
+func TestRecoverResume(t *testing.T) {
+	g := New(Options{Recovery: RecoverResume})
+	g.AddJob(twoStepJob)
+	e := orphan(g)
+
+	g.recoverExecutions()
+	g.wg.Wait()
+
+	recovered, _, _ := g.Executions.Get(e.ID)
+	if recovered.State != StateSuccessful {
+		t.Errorf("Got status %v, expected %v", recovered.State, StateSuccessful)
+	}
+
+	// the first task is not run again
+	if n := len(recovered.TaskExecutions[0].Attempts); n != 1 {
+		t.Errorf("Got %d attempts of the first task, expected %d", n, 1)
+	}
+
+	// the second task gets a new attempt
+	attempts := recovered.TaskExecutions[1].Attempts
+	if len(attempts) != 2 || attempts[0].State != StateFailed || attempts[1].State != StateSuccessful {
+		t.Errorf("Got attempts %+v", attempts)
+	}
+}
+
+func TestUnfinishedExecutions(t *testing.T) {
+	g := New(Options{})
+	g.AddJob(twoStepJob)
+
+	first := orphan(g)
+	for i := 0; i < listBatch; i++ {
+		e := twoStepJob().newExecution(nil)
+		e.State = StateSuccessful
+		saveNewExecution(g.Executions, e)
+	}
+	second := twoStepJob().newExecution(nil)
+	saveNewExecution(g.Executions, second)
+
+	executions, err := unfinishedExecutions(g.Executions, "two-step")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(executions) != 2 || executions[0].ID != first.ID || executions[1].ID != second.ID {
+		t.Errorf("Got %d executions, expected the two unfinished ones, oldest first", len(executions))
+	}
+}
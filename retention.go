@@ -0,0 +1,101 @@
+package goflow
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Retention decides how long executions are kept in the store. Executions
+// older than MaxAge, or beyond the MaxRuns most recent of their job, are
+// deleted. Unfinished executions are never deleted. A zero value keeps
+// everything.
+type Retention struct {
+	MaxAge  time.Duration
+	MaxRuns int
+}
+
+// pruneInterval is how often the retention policy is applied.
+const pruneInterval = time.Hour
+
+// prune applies the retention policy to the executions of all the
+// registered jobs.
+func (g *Goflow) prune() {
+	r := g.Options.Retention
+	if r.MaxAge <= 0 && r.MaxRuns <= 0 {
+		return
+	}
+
+	for _, jobName := range g.jobs {
+		deleted, err := pruneJob(g.Executions, jobName, r, time.Now())
+		if err != nil {
+			log.Printf("job=%v, msg=retention failed, error=%v", jobName, err)
+		}
+		if deleted > 0 {
+			log.Printf("job=%v, msg=deleted %d executions", jobName, deleted)
+		}
+	}
+}
+
+// pruneLoop applies the retention policy periodically, until Shutdown is
+// called.
+func (g *Goflow) pruneLoop() {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			g.prune()
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// pruneBatch is the number of executions read at a time when applying the
+// retention policy.
+const pruneBatch = 100
+
+// pruneJob deletes the executions of a job that are not retained, and
+// returns how many were deleted.
+func pruneJob(s ExecutionStore, jobName string, r Retention, now time.Time) (int, error) {
+	cutoff := time.Time{}
+	if r.MaxAge > 0 {
+		cutoff = now.Add(-r.MaxAge)
+	}
+
+	// walk the executions from the most recent, counting the runs
+	expired := make([]uuid.UUID, 0)
+	kept := 0
+	q := ExecutionQuery{Jobs: []string{jobName}, Limit: pruneBatch}
+	for {
+		executions, next, err := s.List(q)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, e := range executions {
+			submitted, _ := time.Parse(time.RFC3339Nano, e.StartedAt)
+			tooMany := r.MaxRuns > 0 && kept >= r.MaxRuns
+			if e.State.finished() && (tooMany || submitted.Before(cutoff)) {
+				expired = append(expired, e.ID)
+			} else {
+				kept++
+			}
+		}
+
+		if next == "" {
+			break
+		}
+		q.Cursor = next
+	}
+
+	for ix, id := range expired {
+		if err := s.Delete(id); err != nil {
+			return ix, err
+		}
+	}
+	return len(expired), nil
+}
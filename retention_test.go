@@ -0,0 +1,50 @@
+package goflow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/philippgille/gokv/gomap"
+)
+
+func TestPruneJob(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	cases := []struct {
+		retention Retention
+		kept      int
+	}{
+		{Retention{}, 5},
+		{Retention{MaxRuns: 2}, 3},
+		{Retention{MaxAge: 3 * day}, 4},
+		{Retention{MaxAge: 3 * day, MaxRuns: 1}, 2},
+	}
+
+	for _, c := range cases {
+		s := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+		executions := storeExecutions(s, "job", now.Add(-5*day), now.Add(-4*day), now.Add(-2*day), now.Add(-day), now)
+
+		// the oldest execution is still running, so it is kept
+		executions[0].State = StateRunning
+		persistExecution(s, executions[0])
+
+		pruneJob(s, "job", c.retention, now)
+
+		kept, _ := readExecutions(s, "job")
+		if len(kept) != c.kept {
+			t.Errorf("Got %d executions with %+v, expected %d", len(kept), c.retention, c.kept)
+		}
+		if kept[0].ID != executions[0].ID || kept[len(kept)-1].ID != executions[4].ID {
+			t.Errorf("Expected the running and the most recent executions to be kept with %+v", c.retention)
+		}
+
+		buckets, _ := s.readBuckets("job")
+		if len(buckets) != c.kept {
+			t.Errorf("Got %d buckets with %+v, expected the empty ones to be deleted", len(buckets), c.retention)
+		}
+		if _, found, _ := s.Get(executions[1].ID); found != (c.kept == 5) {
+			t.Errorf("Expected the executions not retained to be deleted with %+v", c.retention)
+		}
+	}
+}
@@ -1,10 +1,16 @@
 package goflow
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 func (g *Goflow) addStaticRoutes() *Goflow {
@@ -27,12 +33,12 @@ type jobrun struct {
 }
 
 type jobstate struct {
-	State     state     `json:"job"`
+	State     State     `json:"job"`
 	TaskState taskstate `json:"tasks"`
 }
 
 type taskstate struct {
-	Taskstate map[string]state `json:"state"`
+	Taskstate map[string]State `json:"state"`
 }
 
 func (g *Goflow) addAPIRoutes() *Goflow {
@@ -56,36 +62,37 @@ func (g *Goflow) addAPIRoutes() *Goflow {
 
 		// Deprecated: will be removed in v3.0.0
 		api.GET("/jobruns", func(c *gin.Context) {
-			jobName := c.Query("jobname")
-			stateQuery := c.Query("state")
-
-			jobruns := make([]jobrun, 0)
-
-			for job := range g.Jobs {
-				stored, _ := readExecutions(g.Store, job)
-				for _, execution := range stored {
-					if stateQuery != "" && stateQuery != string(execution.State) {
-					} else if jobName != "" && jobName != execution.JobName {
-					} else {
+			q := ExecutionQuery{Jobs: g.jobs, State: State(c.Query("state"))}
+			if jobName := c.Query("jobname"); jobName != "" {
+				q.Jobs = []string{jobName}
+			}
 
-						t := taskstate{make(map[string]state, 0)}
+			stored, _, err := g.Executions.List(q)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
 
-						for _, task := range execution.TaskExecutions {
-							t.Taskstate[task.Name] = task.State
-						}
+			// the job runs are listed oldest first
+			jobruns := make([]jobrun, 0)
+			for ix := len(stored) - 1; ix >= 0; ix-- {
+				execution := stored[ix]
+				t := taskstate{make(map[string]State, 0)}
 
-						j := jobrun{
-							JobName:   job,
-							Submitted: execution.StartedAt,
-							JobState: jobstate{
-								State:     execution.State,
-								TaskState: t,
-							},
-						}
+				for _, task := range execution.TaskExecutions {
+					t.Taskstate[task.Name] = task.State
+				}
 
-						jobruns = append(jobruns, j)
-					}
+				j := jobrun{
+					JobName:   execution.JobName,
+					Submitted: execution.StartedAt,
+					JobState: jobstate{
+						State:     execution.State,
+						TaskState: t,
+					},
 				}
+
+				jobruns = append(jobruns, j)
 			}
 
 			var msg struct {
@@ -97,26 +104,250 @@ func (g *Goflow) addAPIRoutes() *Goflow {
 		})
 
 		api.GET("/executions", func(c *gin.Context) {
-			jobName := c.Query("jobname")
-			stateQuery := c.Query("state")
-
-			executions := make([]*execution, 0)
-
-			for job := range g.Jobs {
-				stored, _ := readExecutions(g.Store, job)
-				for _, execution := range stored {
-					if stateQuery != "" && stateQuery != string(execution.State) {
-					} else if jobName != "" && jobName != execution.JobName {
-					} else {
-						executions = append(executions, execution)
-					}
+			var msg struct {
+				Executions []*Execution `json:"executions"`
+				Next       string       `json:"next,omitempty"`
+				Error      string       `json:"error,omitempty"`
+			}
+			msg.Executions = make([]*Execution, 0)
+
+			q, err := g.executionQuery(c)
+			if err != nil {
+				msg.Error = err.Error()
+				c.JSON(http.StatusBadRequest, msg)
+				return
+			}
+
+			executions, next, err := g.Executions.List(q)
+			if err == ErrInvalidCursor {
+				msg.Error = err.Error()
+				c.JSON(http.StatusBadRequest, msg)
+				return
+			}
+			if err != nil {
+				msg.Error = err.Error()
+				c.JSON(http.StatusInternalServerError, msg)
+				return
+			}
+
+			for _, e := range executions {
+				msg.Executions = append(msg.Executions, e.withoutLogs())
+			}
+			msg.Next = next
+			c.JSON(http.StatusOK, msg)
+		})
+
+		api.GET("/executions/export", func(c *gin.Context) {
+			// the executions of every job in the store, registered or not
+			jobs := make([]string, 0)
+			if jobName := c.Query("jobname"); jobName != "" {
+				jobs = append(jobs, jobName)
+			}
+
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("Content-Disposition", `attachment; filename="goflow-executions.ndjson"`)
+			c.Status(http.StatusOK)
+
+			// the status is already sent, so an error can only be logged
+			if n, err := Export(c.Writer, g.Executions, jobs...); err != nil {
+				log.Printf("msg=export failed after %d executions, error=%v", n, err)
+			}
+		})
+
+		api.POST("/executions/import", func(c *gin.Context) {
+			var msg struct {
+				ImportResult
+				Success bool   `json:"success"`
+				Error   string `json:"error,omitempty"`
+			}
+
+			result, err := Import(c.Request.Body, g.Executions)
+			msg.ImportResult = result
+			if isStoreError(err) {
+				msg.Error = err.Error()
+				c.JSON(http.StatusInternalServerError, msg)
+				return
+			}
+			if err != nil {
+				msg.Error = err.Error()
+				c.JSON(http.StatusBadRequest, msg)
+				return
+			}
+
+			msg.Success = true
+			c.JSON(http.StatusOK, msg)
+		})
+
+		api.POST("/executions/:id/cancel", func(c *gin.Context) {
+			var msg struct {
+				ID      string `json:"id"`
+				Success bool   `json:"success"`
+			}
+			msg.ID = c.Param("id")
+
+			id, err := uuid.Parse(msg.ID)
+			if err != nil {
+				c.JSON(http.StatusNotFound, msg)
+				return
+			}
+
+			if g.cancel(id) {
+				msg.Success = true
+				c.JSON(http.StatusOK, msg)
+				return
+			}
+
+			// the execution exists but is not running
+			_, found, err := g.Executions.Get(id)
+			switch {
+			case err != nil:
+				c.JSON(http.StatusInternalServerError, msg)
+			case found:
+				c.JSON(http.StatusConflict, msg)
+			default:
+				c.JSON(http.StatusNotFound, msg)
+			}
+		})
+
+		api.POST("/executions/:id/retry", func(c *gin.Context) {
+			var msg struct {
+				ID      string `json:"id"`
+				Success bool   `json:"success"`
+			}
+			msg.ID = c.Param("id")
+
+			id, err := uuid.Parse(msg.ID)
+			if err != nil {
+				c.JSON(http.StatusNotFound, msg)
+				return
+			}
+
+			e, found, err := g.Executions.Get(id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, msg)
+				return
+			}
+			if !found {
+				c.JSON(http.StatusNotFound, msg)
+				return
+			}
+
+			switch err := g.retry(e); err {
+			case nil:
+				msg.Success = true
+				c.JSON(http.StatusOK, msg)
+			case errUnknownJob:
+				c.JSON(http.StatusNotFound, msg)
+			case errShuttingDown:
+				c.JSON(http.StatusServiceUnavailable, msg)
+			default:
+				c.JSON(http.StatusConflict, msg)
+			}
+		})
+
+		api.POST("/executions/:id/tasks/:task/clear", func(c *gin.Context) {
+			var msg struct {
+				ID      string `json:"id"`
+				Task    string `json:"task"`
+				Success bool   `json:"success"`
+			}
+			msg.ID = c.Param("id")
+			msg.Task = c.Param("task")
+
+			e, ok, err := readExecutionTask(g, msg.ID, msg.Task)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, msg)
+				return
+			}
+			if !ok {
+				c.JSON(http.StatusNotFound, msg)
+				return
+			}
+
+			switch err := g.rerun(e, []string{msg.Task}); err {
+			case nil:
+				msg.Success = true
+				c.JSON(http.StatusOK, msg)
+			case errUnknownJob:
+				c.JSON(http.StatusNotFound, msg)
+			case errShuttingDown:
+				c.JSON(http.StatusServiceUnavailable, msg)
+			default:
+				c.JSON(http.StatusConflict, msg)
+			}
+		})
+
+		api.POST("/executions/:id/tasks/:task/mark", func(c *gin.Context) {
+			var msg struct {
+				ID      string `json:"id"`
+				Task    string `json:"task"`
+				State   State  `json:"state"`
+				Success bool   `json:"success"`
+			}
+			msg.ID = c.Param("id")
+			msg.Task = c.Param("task")
+
+			var body struct {
+				State State `json:"state"`
+			}
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, msg)
+				return
+			}
+			msg.State = body.State
+
+			e, ok, err := readExecutionTask(g, msg.ID, msg.Task)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, msg)
+				return
+			}
+			if !ok {
+				c.JSON(http.StatusNotFound, msg)
+				return
+			}
+
+			switch err := g.mark(e, msg.Task, body.State); err {
+			case nil:
+				msg.Success = true
+				c.JSON(http.StatusOK, msg)
+			case errUnknownJob:
+				c.JSON(http.StatusNotFound, msg)
+			case errRunning:
+				c.JSON(http.StatusConflict, msg)
+			default:
+				if isStoreError(err) {
+					c.JSON(http.StatusInternalServerError, msg)
+				} else {
+					c.JSON(http.StatusBadRequest, msg)
 				}
 			}
+		})
 
+		api.GET("/executions/:id/tasks/:task/logs", func(c *gin.Context) {
 			var msg struct {
-				Executions []*execution `json:"executions"`
+				ID       string        `json:"id"`
+				Task     string        `json:"task"`
+				Attempts []TaskAttempt `json:"attempts"`
+			}
+			msg.ID = c.Param("id")
+			msg.Task = c.Param("task")
+			msg.Attempts = make([]TaskAttempt, 0)
+
+			e, ok, err := readExecutionTask(g, msg.ID, msg.Task)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, msg)
+				return
+			}
+			if !ok {
+				c.JSON(http.StatusNotFound, msg)
+				return
+			}
+
+			for _, task := range e.TaskExecutions {
+				if task.Name == msg.Task {
+					msg.Attempts = append(msg.Attempts, task.Attempts...)
+				}
 			}
-			msg.Executions = executions
 
 			c.JSON(http.StatusOK, msg)
 		})
@@ -126,11 +357,12 @@ func (g *Goflow) addAPIRoutes() *Goflow {
 			jobFn, ok := g.Jobs[name]
 
 			var msg struct {
-				JobName   string   `json:"job"`
-				TaskNames []string `json:"tasks"`
-				Dag       dag      `json:"dag"`
-				Schedule  string   `json:"schedule"`
-				Active    bool     `json:"active"`
+				JobName   string           `json:"job"`
+				TaskNames []string         `json:"tasks"`
+				Dag       dag              `json:"dag"`
+				Schedule  string           `json:"schedule"`
+				Active    bool             `json:"active"`
+				Params    map[string]Param `json:"params,omitempty"`
 			}
 
 			if ok {
@@ -138,13 +370,8 @@ func (g *Goflow) addAPIRoutes() *Goflow {
 				msg.TaskNames = jobFn().tasks
 				msg.Dag = jobFn().Dag
 				msg.Schedule = g.Jobs[name]().Schedule
-
-				// check if the job is active by looking in the list of cron entries
-				for _, entry := range g.cron.Entries() {
-					if jobName := entry.Job.(*scheduledExecution).jobFunc().Name; name == jobName {
-						msg.Active = true
-					}
-				}
+				msg.Params = jobFn().Params
+				msg.Active = g.isActive(name)
 
 				c.JSON(http.StatusOK, msg)
 			} else {
@@ -158,13 +385,53 @@ func (g *Goflow) addAPIRoutes() *Goflow {
 
 			var msg struct {
 				Job       string `json:"job"`
+				ID        string `json:"id,omitempty"`
 				Success   bool   `json:"success"`
 				Submitted string `json:"submitted"`
+				Error     string `json:"error,omitempty"`
 			}
 			msg.Job = name
 
 			if ok {
-				g.execute(name)
+				// the body is an optional JSON object of params
+				var params map[string]interface{}
+				if c.Request.Body != nil {
+					body, _ := c.GetRawData()
+					if len(body) > 0 {
+						if err := json.Unmarshal(body, &params); err != nil {
+							msg.Error = err.Error()
+							c.JSON(http.StatusBadRequest, msg)
+							return
+						}
+					}
+				}
+
+				id, err := g.execute(name, params)
+				if err == errShuttingDown {
+					msg.Success = false
+					c.JSON(http.StatusServiceUnavailable, msg)
+					return
+				}
+				if err == errSkipped {
+					msg.ID = id.String()
+					msg.Success = false
+					msg.Error = err.Error()
+					c.JSON(http.StatusConflict, msg)
+					return
+				}
+				if isStoreError(err) {
+					msg.Success = false
+					msg.Error = err.Error()
+					c.JSON(http.StatusInternalServerError, msg)
+					return
+				}
+				if err != nil {
+					msg.Success = false
+					msg.Error = err.Error()
+					c.JSON(http.StatusBadRequest, msg)
+					return
+				}
+				msg.ID = id.String()
 				msg.Success = true
 				msg.Submitted = time.Now().UTC().Format(time.RFC3339Nano)
 				c.JSON(http.StatusOK, msg)
@@ -174,6 +441,66 @@ func (g *Goflow) addAPIRoutes() *Goflow {
 			}
 		})
 
+		api.POST("/jobs/:name/backfill", func(c *gin.Context) {
+			name := c.Param("name")
+			_, ok := g.Jobs[name]
+
+			var msg struct {
+				Job        string   `json:"job"`
+				Executions []string `json:"executions"`
+				Success    bool     `json:"success"`
+				Error      string   `json:"error,omitempty"`
+			}
+			msg.Job = name
+			msg.Executions = make([]string, 0)
+
+			if !ok {
+				c.JSON(http.StatusNotFound, msg)
+				return
+			}
+
+			start, err := time.Parse(time.RFC3339, c.Query("start"))
+			if err != nil {
+				msg.Error = "Invalid start: " + err.Error()
+				c.JSON(http.StatusBadRequest, msg)
+				return
+			}
+			end, err := time.Parse(time.RFC3339, c.Query("end"))
+			if err != nil || !end.After(start) {
+				msg.Error = "Invalid end, it must be a time after start"
+				c.JSON(http.StatusBadRequest, msg)
+				return
+			}
+			concurrency, err := strconv.Atoi(c.DefaultQuery("concurrency", "1"))
+			if err != nil || concurrency < 1 {
+				msg.Error = "Invalid concurrency, it must be a positive integer"
+				c.JSON(http.StatusBadRequest, msg)
+				return
+			}
+
+			ids, err := g.backfill(name, start, end, concurrency)
+			if err == errShuttingDown {
+				c.JSON(http.StatusServiceUnavailable, msg)
+				return
+			}
+			if isStoreError(err) {
+				msg.Error = err.Error()
+				c.JSON(http.StatusInternalServerError, msg)
+				return
+			}
+			if err != nil {
+				msg.Error = err.Error()
+				c.JSON(http.StatusBadRequest, msg)
+				return
+			}
+
+			for _, id := range ids {
+				msg.Executions = append(msg.Executions, id.String())
+			}
+			msg.Success = true
+			c.JSON(http.StatusOK, msg)
+		})
+
 		api.POST("/jobs/:name/toggle", func(c *gin.Context) {
 			name := c.Param("name")
 			_, ok := g.Jobs[name]
@@ -182,11 +509,18 @@ func (g *Goflow) addAPIRoutes() *Goflow {
 				Job     string `json:"job"`
 				Success bool   `json:"success"`
 				Active  bool   `json:"active"`
+				Error   string `json:"error,omitempty"`
 			}
 			msg.Job = name
 
 			if ok {
-				isActive, _ := g.toggle(name)
+				isActive, err := g.toggle(name)
+				if err != nil {
+					msg.Success = false
+					msg.Error = err.Error()
+					c.JSON(http.StatusBadRequest, msg)
+					return
+				}
 				msg.Success = true
 				msg.Active = isActive
 				c.JSON(http.StatusOK, msg)
@@ -245,3 +579,74 @@ func (g *Goflow) addUIRoutes() *Goflow {
 
 	return g
 }
+
+// readExecutionTask reads an execution from the store, and returns false if
+// the execution or the task doesn't exist.
+func readExecutionTask(g *Goflow, executionID, taskName string) (*Execution, bool, error) {
+	id, err := uuid.Parse(executionID)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	e, found, err := g.Executions.Get(id)
+	if err != nil || !found {
+		return nil, false, err
+	}
+
+	for _, task := range e.TaskExecutions {
+		if task.Name == taskName {
+			return e, true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
+// isStoreError returns true if the error comes from the Store.
+func isStoreError(err error) bool {
+	var e storeError
+	return errors.As(err, &e)
+}
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// executionQuery reads the filters and the page of /api/executions from
+// the query string.
+func (g *Goflow) executionQuery(c *gin.Context) (ExecutionQuery, error) {
+	q := ExecutionQuery{
+		Jobs:   g.jobs,
+		State:  State(c.Query("state")),
+		Cursor: c.Query("cursor"),
+		Limit:  defaultPageSize,
+	}
+
+	if jobName := c.Query("jobname"); jobName != "" {
+		q.Jobs = []string{jobName}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageSize {
+			return q, fmt.Errorf("Invalid limit, it must be between 1 and %d", maxPageSize)
+		}
+		q.Limit = n
+	}
+
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if v := c.Query(bound.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return q, fmt.Errorf("Invalid %s: %v", bound.name, err)
+			}
+			*bound.t = t
+		}
+	}
+
+	return q, nil
+}
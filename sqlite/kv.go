@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/philippgille/gokv"
+	"github.com/philippgille/gokv/encoding"
+	"github.com/philippgille/gokv/util"
+)
+
+// kv is a gokv.Store in the kv table of the database.
+type kv struct {
+	db    *sql.DB
+	codec encoding.Codec
+}
+
+// KV returns a gokv.Store in the same database, to pass in Options.Store
+// so that the schedules of the jobs are kept along with their executions.
+// Closing it doesn't close the database.
+func (s *Store) KV() gokv.Store {
+	return kv{db: s.db, codec: encoding.JSON}
+}
+
+// Set stores the given value for the given key.
+func (s kv) Set(k string, v interface{}) error {
+	if err := util.CheckKeyAndValue(k, v); err != nil {
+		return err
+	}
+	data, err := s.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO kv (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`, k, data)
+	return err
+}
+
+// Get retrieves the stored value for the given key, and returns false if
+// there is none.
+func (s kv) Get(k string, v interface{}) (bool, error) {
+	if err := util.CheckKeyAndValue(k, v); err != nil {
+		return false, err
+	}
+	var data []byte
+	err := s.db.QueryRow(`SELECT value FROM kv WHERE key = ?`, k).Scan(&data)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, s.codec.Unmarshal(data, v)
+}
+
+// Delete deletes the stored value for the given key.
+func (s kv) Delete(k string) error {
+	if err := util.CheckKey(k); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`DELETE FROM kv WHERE key = ?`, k)
+	return err
+}
+
+// Close does nothing, the database is closed by Store.Close.
+func (s kv) Close() error {
+	return nil
+}
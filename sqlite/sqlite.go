@@ -0,0 +1,528 @@
+// Package sqlite keeps the executions of Goflow jobs in an embedded SQLite
+// database. Executions, tasks, task attempts and their logs have their own
+// tables, and the executions are indexed by job, by state and by the time
+// they were submitted, so that the API queries don't scan the history.
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fieldryand/goflow/v2"
+	"github.com/google/uuid"
+
+	// the pure Go SQLite driver
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS executions (
+	id             TEXT PRIMARY KEY,
+	job            TEXT NOT NULL,
+	state          TEXT NOT NULL,
+	submitted      TEXT NOT NULL,
+	submitted_ns   INTEGER NOT NULL,
+	modified       TEXT NOT NULL,
+	params         TEXT,
+	interval_start TEXT NOT NULL DEFAULT '',
+	interval_end   TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS executions_by_time ON executions (submitted_ns, id);
+CREATE INDEX IF NOT EXISTS executions_by_job ON executions (job, submitted_ns, id);
+CREATE INDEX IF NOT EXISTS executions_by_state ON executions (state, submitted_ns, id);
+
+CREATE TABLE IF NOT EXISTS tasks (
+	execution_id TEXT NOT NULL,
+	position     INTEGER NOT NULL,
+	name         TEXT NOT NULL,
+	state        TEXT NOT NULL,
+	error        TEXT NOT NULL DEFAULT '',
+	result       TEXT,
+	PRIMARY KEY (execution_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS task_attempts (
+	execution_id TEXT NOT NULL,
+	task         TEXT NOT NULL,
+	attempt      INTEGER NOT NULL,
+	state        TEXT NOT NULL,
+	started_at   TEXT NOT NULL DEFAULT '',
+	ended_at     TEXT NOT NULL DEFAULT '',
+	duration_ms  INTEGER NOT NULL DEFAULT 0,
+	exit_code    INTEGER,
+	error        TEXT NOT NULL DEFAULT '',
+	rendered     TEXT,
+	PRIMARY KEY (execution_id, task, attempt)
+);
+
+CREATE TABLE IF NOT EXISTS task_logs (
+	execution_id TEXT NOT NULL,
+	task         TEXT NOT NULL,
+	attempt      INTEGER NOT NULL,
+	stdout       TEXT NOT NULL DEFAULT '',
+	stderr       TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (execution_id, task, attempt)
+);
+
+CREATE TABLE IF NOT EXISTS kv (
+	key   TEXT PRIMARY KEY,
+	value BLOB NOT NULL
+);
+`
+
+// Store is a goflow.ExecutionStore backed by SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+var _ goflow.ExecutionStore = (*Store)(nil)
+
+// Open opens the SQLite database at a path, creating it and its tables if
+// necessary. Use ":memory:" for a database that lives as long as the
+// Store.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite has a single writer, so one connection avoids busy errors,
+	// and keeps an in-memory database alive
+	db.SetMaxOpenConns(1)
+
+	for _, pragma := range []string{"PRAGMA journal_mode = WAL", "PRAGMA busy_timeout = 5000"} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to create the tables: %v", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Save creates or replaces an execution, with its tasks, attempts and
+// logs. Only the tasks and attempts that changed are written, and the logs
+// of an attempt are written once it has finished.
+func (s *Store) Save(e *goflow.Execution) error {
+	submitted, err := time.Parse(time.RFC3339Nano, e.StartedAt)
+	if err != nil {
+		return fmt.Errorf("Invalid submission time %s: %v", e.StartedAt, err)
+	}
+	params, err := marshal(e.Params)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO executions (id, job, state, submitted, submitted_ns, modified, params, interval_start, interval_end)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			job = excluded.job,
+			state = excluded.state,
+			submitted = excluded.submitted,
+			submitted_ns = excluded.submitted_ns,
+			modified = excluded.modified,
+			params = excluded.params,
+			interval_start = excluded.interval_start,
+			interval_end = excluded.interval_end`,
+		e.ID.String(), e.JobName, string(e.State), e.StartedAt, submitted.UnixNano(), e.ModifiedTimestamp,
+		params, e.IntervalStart, e.IntervalEnd)
+	if err != nil {
+		return err
+	}
+
+	names := make([]interface{}, 0, len(e.TaskExecutions))
+	for ix, task := range e.TaskExecutions {
+		if err := saveTask(tx, e.ID, ix, task); err != nil {
+			return err
+		}
+		names = append(names, task.Name)
+	}
+
+	// the tasks removed from the job
+	for _, table := range []string{"tasks", "task_attempts", "task_logs"} {
+		column := "task"
+		if table == "tasks" {
+			column = "name"
+		}
+		query := `DELETE FROM ` + table + ` WHERE execution_id = ?` + notIn(column, len(names))
+		if _, err := tx.Exec(query, append([]interface{}{e.ID.String()}, names...)...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// saveTask creates or updates a task of an execution and its attempts.
+func saveTask(tx *sql.Tx, id uuid.UUID, position int, task goflow.TaskExecution) error {
+	result, err := marshal(task.Result)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO tasks (execution_id, position, name, state, error, result)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (execution_id, name) DO UPDATE SET
+			position = excluded.position,
+			state = excluded.state,
+			error = excluded.error,
+			result = excluded.result
+		WHERE (position, state, error, result) IS NOT (excluded.position, excluded.state, excluded.error, excluded.result)`,
+		id.String(), position, task.Name, string(task.State), task.Error, result)
+	if err != nil {
+		return err
+	}
+
+	attempts := make([]interface{}, 0, len(task.Attempts))
+	for _, a := range task.Attempts {
+		if err := saveAttempt(tx, id, task.Name, a); err != nil {
+			return err
+		}
+		attempts = append(attempts, a.Attempt)
+	}
+
+	// the attempts cleared since the last save
+	for _, table := range []string{"task_attempts", "task_logs"} {
+		query := `DELETE FROM ` + table + ` WHERE execution_id = ? AND task = ?` + notIn("attempt", len(attempts))
+		if _, err := tx.Exec(query, append([]interface{}{id.String(), task.Name}, attempts...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveAttempt creates or updates an attempt of a task, and its logs once it
+// has finished.
+func saveAttempt(tx *sql.Tx, id uuid.UUID, task string, a goflow.TaskAttempt) error {
+	rendered, err := marshal(a.Rendered)
+	if err != nil {
+		return err
+	}
+	var exitCode sql.NullInt64
+	if a.ExitCode != nil {
+		exitCode = sql.NullInt64{Int64: int64(*a.ExitCode), Valid: true}
+	}
+	_, err = tx.Exec(`
+		INSERT INTO task_attempts (execution_id, task, attempt, state, started_at, ended_at, duration_ms, exit_code, error, rendered)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (execution_id, task, attempt) DO UPDATE SET
+			state = excluded.state,
+			started_at = excluded.started_at,
+			ended_at = excluded.ended_at,
+			duration_ms = excluded.duration_ms,
+			exit_code = excluded.exit_code,
+			error = excluded.error,
+			rendered = excluded.rendered
+		WHERE (state, started_at, ended_at, duration_ms, exit_code, error, rendered)
+			IS NOT (excluded.state, excluded.started_at, excluded.ended_at, excluded.duration_ms, excluded.exit_code, excluded.error, excluded.rendered)`,
+		id.String(), task, a.Attempt, string(a.State), a.StartedAt, a.EndedAt, a.DurationMs, exitCode, a.Error, rendered)
+	if err != nil {
+		return err
+	}
+
+	if err != nil || !finished(a) || (a.Stdout == "" && a.Stderr == "") {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO task_logs (execution_id, task, attempt, stdout, stderr) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (execution_id, task, attempt) DO UPDATE SET stdout = excluded.stdout, stderr = excluded.stderr
+		WHERE (stdout, stderr) IS NOT (excluded.stdout, excluded.stderr)`,
+		id.String(), task, a.Attempt, a.Stdout, a.Stderr)
+	return err
+}
+
+// finished returns true if an attempt has ended, so its logs are complete.
+func finished(a goflow.TaskAttempt) bool {
+	switch a.State {
+	case goflow.StateSuccessful, goflow.StateFailed, goflow.StateUpForRetry, goflow.StateSkipped, goflow.StateCancelled:
+		return true
+	}
+	return a.EndedAt != ""
+}
+
+// notIn returns a condition excluding n values of a column, or nothing if
+// n is 0.
+func notIn(column string, n int) string {
+	if n == 0 {
+		return ""
+	}
+	return " AND " + column + " NOT IN (?" + strings.Repeat(", ?", n-1) + ")"
+}
+
+// Get reads an execution by its ID.
+func (s *Store) Get(id uuid.UUID) (*goflow.Execution, bool, error) {
+	e := goflow.Execution{ID: id}
+	var state string
+	var params sql.NullString
+
+	row := s.db.QueryRow(`
+		SELECT job, state, submitted, modified, params, interval_start, interval_end
+		FROM executions WHERE id = ?`, id.String())
+	err := row.Scan(&e.JobName, &state, &e.StartedAt, &e.ModifiedTimestamp, &params, &e.IntervalStart, &e.IntervalEnd)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	e.State = goflow.State(state)
+	if err := unmarshal(params, &e.Params); err != nil {
+		return nil, false, err
+	}
+
+	tasks, err := s.readTasks(id)
+	if err != nil {
+		return nil, false, err
+	}
+	e.TaskExecutions = tasks
+
+	return &e, true, nil
+}
+
+// readTasks reads the tasks of an execution, in the order of the job, with
+// their attempts and logs.
+func (s *Store) readTasks(id uuid.UUID) ([]goflow.TaskExecution, error) {
+	rows, err := s.db.Query(`SELECT name, state, error, result FROM tasks WHERE execution_id = ? ORDER BY position`, id.String())
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]goflow.TaskExecution, 0)
+	position := make(map[string]int)
+	for rows.Next() {
+		var t goflow.TaskExecution
+		var state string
+		var result sql.NullString
+		if err := rows.Scan(&t.Name, &state, &t.Error, &result); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		t.State = goflow.State(state)
+		if err := unmarshal(result, &t.Result); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		position[t.Name] = len(tasks)
+		tasks = append(tasks, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(`
+		SELECT a.task, a.attempt, a.state, a.started_at, a.ended_at, a.duration_ms, a.exit_code, a.error, a.rendered,
+			COALESCE(l.stdout, ''), COALESCE(l.stderr, '')
+		FROM task_attempts a
+		LEFT JOIN task_logs l ON l.execution_id = a.execution_id AND l.task = a.task AND l.attempt = a.attempt
+		WHERE a.execution_id = ?
+		ORDER BY a.task, a.attempt`, id.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var task, state string
+		var a goflow.TaskAttempt
+		var exitCode sql.NullInt64
+		var rendered sql.NullString
+		err := rows.Scan(&task, &a.Attempt, &state, &a.StartedAt, &a.EndedAt, &a.DurationMs, &exitCode, &a.Error, &rendered,
+			&a.Stdout, &a.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		a.State = goflow.State(state)
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			a.ExitCode = &code
+		}
+		if err := unmarshal(rendered, &a.Rendered); err != nil {
+			return nil, err
+		}
+		if ix, ok := position[task]; ok {
+			tasks[ix].Attempts = append(tasks[ix].Attempts, a)
+		}
+	}
+
+	return tasks, rows.Err()
+}
+
+// List returns the executions selected by the query, most recent first.
+// The filters run on the indexes of the executions table.
+func (s *Store) List(q goflow.ExecutionQuery) ([]*goflow.Execution, string, error) {
+	where := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if len(q.Jobs) > 0 {
+		where = append(where, "job IN (?"+strings.Repeat(", ?", len(q.Jobs)-1)+")")
+		for _, job := range q.Jobs {
+			args = append(args, job)
+		}
+	}
+	if q.State != "" {
+		where = append(where, "state = ?")
+		args = append(args, string(q.State))
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "submitted_ns >= ?")
+		args = append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "submitted_ns < ?")
+		args = append(args, q.Until.UnixNano())
+	}
+	if q.Cursor != "" {
+		submitted, id, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		where = append(where, "(submitted_ns, id) < (?, ?)")
+		args = append(args, submitted, id)
+	}
+
+	query := "SELECT id, submitted_ns FROM executions"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY submitted_ns DESC, id DESC"
+	if q.Limit > 0 {
+		// one more row tells if there is a next page
+		query += " LIMIT ?"
+		args = append(args, q.Limit+1)
+	}
+
+	type key struct {
+		id        string
+		submitted int64
+	}
+	keys := make([]key, 0)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	for rows.Next() {
+		var k key
+		if err := rows.Scan(&k.id, &k.submitted); err != nil {
+			rows.Close()
+			return nil, "", err
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if q.Limit > 0 && len(keys) > q.Limit {
+		keys = keys[:q.Limit]
+		last := keys[len(keys)-1]
+		next = encodeCursor(last.submitted, last.id)
+	}
+
+	executions := make([]*goflow.Execution, 0, len(keys))
+	for _, k := range keys {
+		id, err := uuid.Parse(k.id)
+		if err != nil {
+			return nil, "", err
+		}
+		e, found, err := s.Get(id)
+		if err != nil {
+			return nil, "", err
+		}
+		if found {
+			executions = append(executions, e)
+		}
+	}
+
+	return executions, next, nil
+}
+
+// Delete removes an execution, with its tasks, attempts and logs.
+func (s *Store) Delete(id uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM executions WHERE id = ?`, id.String()); err != nil {
+		return err
+	}
+	if err := deleteTasks(tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteTasks deletes the tasks, attempts and logs of an execution.
+func deleteTasks(tx *sql.Tx, id uuid.UUID) error {
+	for _, table := range []string{"tasks", "task_attempts", "task_logs"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE execution_id = ?`, id.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeCursor returns an opaque cursor pointing after an execution.
+func encodeCursor(submitted int64, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(submitted, 10) + "|" + id))
+}
+
+// decodeCursor reads a cursor returned by encodeCursor.
+func decodeCursor(cursor string) (int64, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", goflow.ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(b), "|", 2)
+	if len(parts) != 2 {
+		return 0, "", goflow.ErrInvalidCursor
+	}
+	submitted, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", goflow.ErrInvalidCursor
+	}
+	if _, err := uuid.Parse(parts[1]); err != nil {
+		return 0, "", goflow.ErrInvalidCursor
+	}
+	return submitted, parts[1], nil
+}
+
+// marshal encodes a value as JSON, or as NULL if it is empty.
+func marshal(v interface{}) (sql.NullString, error) {
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// unmarshal decodes a value encoded by marshal.
+func unmarshal(s sql.NullString, v interface{}) error {
+	if !s.Valid {
+		return nil
+	}
+	return json.Unmarshal([]byte(s.String), v)
+}
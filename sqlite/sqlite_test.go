@@ -0,0 +1,246 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fieldryand/goflow/v2"
+	"github.com/google/uuid"
+)
+
+func open(t *testing.T) *Store {
+	s, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func execution(job string, submitted time.Time, state goflow.State) *goflow.Execution {
+	return &goflow.Execution{
+		ID:                uuid.New(),
+		JobName:           job,
+		StartedAt:         submitted.UTC().Format(time.RFC3339Nano),
+		ModifiedTimestamp: submitted.UTC().Format(time.RFC3339Nano),
+		State:             state,
+		TaskExecutions:    []goflow.TaskExecution{{Name: "first", State: state}, {Name: "second", State: state}},
+	}
+}
+
+func TestSaveAndGet(t *testing.T) {
+	s := open(t)
+
+	code := 1
+	e := execution("job", time.Now(), goflow.StateFailed)
+	e.Params = map[string]interface{}{"n": 1.5, "name": "x"}
+	e.IntervalStart = "2024-01-01T00:00:00Z"
+	e.IntervalEnd = "2024-01-01T01:00:00Z"
+	e.TaskExecutions[0].Result = "2\n"
+	e.TaskExecutions[1].Error = "exit status 1"
+	e.TaskExecutions[1].Attempts = []goflow.TaskAttempt{
+		{Attempt: 1, State: goflow.StateUpForRetry, StartedAt: "a", EndedAt: "b", DurationMs: 3, ExitCode: &code, Stderr: "oops", Error: "exit status 1"},
+		{Attempt: 2, State: goflow.StateFailed, Stdout: "out", Rendered: map[string]string{"Cmd": "echo x"}},
+	}
+
+	if err := s.Save(e); err != nil {
+		t.Fatal(err)
+	}
+	got, found, err := s.Get(e.ID)
+	if err != nil || !found {
+		t.Fatalf("Expected the execution to be found, got %v", err)
+	}
+	if !reflect.DeepEqual(got, e) {
+		t.Errorf("Got %+v, expected %+v", got, e)
+	}
+
+	// saving again replaces the tasks and attempts
+	e.State = goflow.StateSuccessful
+	e.TaskExecutions[1].Attempts = e.TaskExecutions[1].Attempts[:1]
+	if err := s.Save(e); err != nil {
+		t.Fatal(err)
+	}
+	got, _, _ = s.Get(e.ID)
+	if got.State != goflow.StateSuccessful || len(got.TaskExecutions[1].Attempts) != 1 {
+		t.Errorf("Expected the execution to be updated, got %+v", got)
+	}
+
+	if _, found, err := s.Get(uuid.New()); found || err != nil {
+		t.Errorf("Expected a missing execution not to be found, got %v", err)
+	}
+}
+
+func TestSaveChanges(t *testing.T) {
+	s := open(t)
+	changes := func() (n int) {
+		s.db.QueryRow(`SELECT total_changes()`).Scan(&n)
+		return n
+	}
+
+	e := execution("job", time.Now(), goflow.StateRunning)
+	e.TaskExecutions[0].Attempts = []goflow.TaskAttempt{{Attempt: 1, State: goflow.StateRunning, Stdout: "partial"}}
+	s.Save(e)
+
+	// the logs of a running attempt are not written
+	var logs int
+	s.db.QueryRow(`SELECT COUNT(*) FROM task_logs`).Scan(&logs)
+	if logs != 0 {
+		t.Errorf("Got %d logs, expected none while the attempt is running", logs)
+	}
+
+	// only the execution is written when nothing else changed
+	before := changes()
+	s.Save(e)
+	if n := changes() - before; n != 1 {
+		t.Errorf("Got %d rows written, expected 1", n)
+	}
+
+	// only the finished attempt, its task and its logs are written
+	e.TaskExecutions[0].State = goflow.StateSuccessful
+	e.TaskExecutions[0].Attempts[0].State = goflow.StateSuccessful
+	e.TaskExecutions[0].Attempts[0].Stdout = "done"
+	before = changes()
+	s.Save(e)
+	if n := changes() - before; n != 4 {
+		t.Errorf("Got %d rows written, expected 4", n)
+	}
+	got, _, _ := s.Get(e.ID)
+	if got.TaskExecutions[0].Attempts[0].Stdout != "done" {
+		t.Errorf("Got logs %q, expected the logs of the finished attempt", got.TaskExecutions[0].Attempts[0].Stdout)
+	}
+
+	// the tasks that are no longer in the execution are deleted
+	e.TaskExecutions = e.TaskExecutions[1:]
+	s.Save(e)
+	got, _, _ = s.Get(e.ID)
+	s.db.QueryRow(`SELECT COUNT(*) FROM task_logs`).Scan(&logs)
+	if len(got.TaskExecutions) != 1 || logs != 0 {
+		t.Errorf("Got %d tasks and %d logs, expected the first task to be deleted", len(got.TaskExecutions), logs)
+	}
+}
+
+func TestList(t *testing.T) {
+	s := open(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	expected := make([]*goflow.Execution, 0)
+	for ix := 0; ix < 7; ix++ {
+		job := []string{"a", "b"}[ix%2]
+		state := []goflow.State{goflow.StateSuccessful, goflow.StateFailed, goflow.StateSuccessful}[ix%3]
+		e := execution(job, start.Add(time.Duration(ix)*20*time.Minute), state)
+		s.Save(e)
+		expected = append([]*goflow.Execution{e}, expected...)
+	}
+
+	// page through everything, most recent first
+	got := make([]*goflow.Execution, 0)
+	q := goflow.ExecutionQuery{Limit: 3}
+	for pages := 0; pages < 5; pages++ {
+		page, next, err := s.List(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, page...)
+		if next == "" {
+			break
+		}
+		q.Cursor = next
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Got %d executions, expected %d", len(got), len(expected))
+	}
+	for ix := range expected {
+		if got[ix].ID != expected[ix].ID {
+			t.Errorf("Got execution %d submitted at %v, expected %v", ix, got[ix].StartedAt, expected[ix].StartedAt)
+		}
+	}
+
+	cases := []struct {
+		q     goflow.ExecutionQuery
+		count int
+	}{
+		{goflow.ExecutionQuery{Jobs: []string{"a"}}, 4},
+		{goflow.ExecutionQuery{Jobs: []string{"a", "b"}}, 7},
+		{goflow.ExecutionQuery{State: goflow.StateFailed}, 2},
+		{goflow.ExecutionQuery{Jobs: []string{"b"}, State: goflow.StateFailed}, 1},
+		{goflow.ExecutionQuery{Since: start.Add(40 * time.Minute), Until: start.Add(100 * time.Minute)}, 3},
+	}
+	for _, c := range cases {
+		page, _, err := s.List(c.q)
+		if err != nil || len(page) != c.count {
+			t.Errorf("Got %d executions for %+v, expected %d", len(page), c.q, c.count)
+		}
+	}
+
+	if _, _, err := s.List(goflow.ExecutionQuery{Cursor: "!"}); err != goflow.ErrInvalidCursor {
+		t.Errorf("Expected an invalid cursor error, got %v", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	s := open(t)
+	e := execution("job", time.Now(), goflow.StateSuccessful)
+	s.Save(e)
+
+	if err := s.Delete(e.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := s.Get(e.ID); found {
+		t.Errorf("Expected the execution to be deleted")
+	}
+	var tasks int
+	s.db.QueryRow(`SELECT COUNT(*) FROM tasks`).Scan(&tasks)
+	if tasks != 0 {
+		t.Errorf("Got %d tasks, expected the tasks to be deleted", tasks)
+	}
+	if err := s.Delete(e.ID); err != nil {
+		t.Errorf("Expected no error when deleting a missing execution, got %v", err)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goflow.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := execution("job", time.Now(), goflow.StateSuccessful)
+	s.Save(e)
+	s.KV().Set("goflow:schedule:job", map[string]bool{"active": false})
+	s.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, found, _ := s.Get(e.ID); !found {
+		t.Errorf("Expected the execution to be kept")
+	}
+	if found, _ := s.KV().Get("goflow:schedule:job", &map[string]bool{}); !found {
+		t.Errorf("Expected the schedule to be kept")
+	}
+}
+
+func TestKV(t *testing.T) {
+	kv := open(t).KV()
+
+	var v struct{ Name string }
+	if found, err := kv.Get("key", &v); found || err != nil {
+		t.Errorf("Expected a missing key not to be found, got %v", err)
+	}
+	kv.Set("key", struct{ Name string }{"x"})
+	kv.Set("key", struct{ Name string }{"y"})
+	if found, _ := kv.Get("key", &v); !found || v.Name != "y" {
+		t.Errorf("Got %v, expected the last value", v)
+	}
+	kv.Delete("key")
+	if found, _ := kv.Get("key", &v); found {
+		t.Errorf("Expected the key to be deleted")
+	}
+	if err := kv.Set("", v); err == nil {
+		t.Errorf("Expected an error for an empty key")
+	}
+}
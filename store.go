@@ -0,0 +1,59 @@
+package goflow
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// An ExecutionStore persists the executions of jobs. By default Goflow uses
+// a KVStore on top of Options.Store. Another implementation, for example
+// one running SQL queries, can be passed in Options.Executions.
+type ExecutionStore interface {
+	// Save creates or replaces an execution.
+	Save(e *Execution) error
+
+	// Get reads an execution by its ID. It returns false if the execution
+	// doesn't exist.
+	Get(id uuid.UUID) (*Execution, bool, error)
+
+	// List returns the executions selected by the query, most recent
+	// first, along with the cursor of the next page. The cursor is empty
+	// on the last page.
+	List(q ExecutionQuery) ([]*Execution, string, error)
+
+	// Delete removes an execution. It is not an error if the execution
+	// doesn't exist.
+	Delete(id uuid.UUID) error
+}
+
+// An ExecutionQuery selects executions by job, by state and by the time
+// they were submitted. Executions submitted at the same time are ordered
+// by ID.
+type ExecutionQuery struct {
+	Jobs   []string  // the executions of these jobs, or of all the jobs if empty
+	State  State     // the executions in this state, if not empty
+	Since  time.Time // submitted at or after this time, if not zero
+	Until  time.Time // submitted before this time, if not zero
+	Cursor string    // the cursor returned with the previous page, if any
+	Limit  int       // no limit if zero
+}
+
+// ErrInvalidCursor is returned by List when the cursor of the query was
+// not returned by the store.
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// A storeError is an error of the store, as opposed to an invalid
+// request.
+type storeError struct {
+	err error
+}
+
+func (e storeError) Error() string {
+	return e.err.Error()
+}
+
+func (e storeError) Unwrap() error {
+	return e.err
+}
@@ -2,49 +2,83 @@ package goflow
 
 import (
 	"io"
+	"log"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
+// streamSize is the number of recent executions of each job checked for
+// changes on each poll of the stream.
+const streamSize = 100
+
 // Set keepOpen to false when testing--one event will be sent and
 // then the channel is closed by the server.
 func (g *Goflow) stream(keepOpen bool) func(*gin.Context) {
 
 	return func(c *gin.Context) {
-		job := c.Query("jobname")
+		jobs := g.jobs
+		if job := c.Query("jobname"); job != "" {
+			jobs = []string{job}
+		}
+
+		// the last version of each execution that was sent
+		history := make(map[uuid.UUID]string)
 
-		history := make([]*execution, 0)
+		send := func(e *Execution) {
+			if history[e.ID] != e.ModifiedTimestamp {
+				c.SSEvent("message", e.withoutLogs())
+				history[e.ID] = e.ModifiedTimestamp
+			}
+		}
 
-		// periodically push the list of job runs into the stream
+		// periodically push the recent and running executions into the stream
 		c.Stream(func(w io.Writer) bool {
-			for jobname := range g.Jobs {
-				executions, _ := readExecutions(g.Store, jobname)
-				for _, e := range executions {
-
-					// make sure it wasn't already sent
-					inHistory := false
-
-					for _, h := range history {
-						if e.ID == h.ID && e.ModifiedTimestamp == h.ModifiedTimestamp {
-							inHistory = true
-						}
-					}
-
-					if !inHistory {
-						if (job != "" && job == e.JobName) || job == "" {
-							c.SSEvent("message", e)
-							history = append(history, e)
-						}
-					}
+			// each job is listed on its own, so that a job that runs often
+			// doesn't push the others out of the window
+			for _, job := range jobs {
+				recent, _, err := g.Executions.List(ExecutionQuery{Jobs: []string{job}, Limit: streamSize})
+				if err != nil {
+					log.Printf("job=%v, msg=failed to list the executions to stream, error=%v", job, err)
+				}
+				for ix := len(recent) - 1; ix >= 0; ix-- {
+					send(recent[ix])
+				}
+			}
 
+			for _, id := range g.activeIDs() {
+				e, found, err := g.Executions.Get(id)
+				if err != nil {
+					log.Printf("jobID=%v, msg=failed to read the execution to stream, error=%v", id, err)
+				}
+				if found && contains(jobs, e.JobName) {
+					send(e)
 				}
 			}
 
 			time.Sleep(time.Second * 1)
 
-			return keepOpen
+			// let the webserver shut down
+			return keepOpen && !g.isClosing()
 		})
 	}
 
 }
+
+// activeIDs returns the IDs of the running and queued executions.
+func (g *Goflow) activeIDs() []uuid.UUID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ids := make([]uuid.UUID, 0, len(g.running))
+	for id := range g.running {
+		ids = append(ids, id)
+	}
+	for _, queue := range g.queued {
+		for _, q := range queue {
+			ids = append(ids, q.e.ID)
+		}
+	}
+	return ids
+}
@@ -1,72 +1,278 @@
 package goflow
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
 	"time"
 )
 
 // A Task is the unit of work that makes up a job. Whenever a task is executed, it
-// calls its associated operator.
+// calls its associated operator. When Templated is set, the templates in the
+// operator's string fields are rendered before each attempt.
 type Task struct {
 	Name        string
 	Operator    Operator
-	TriggerRule triggerRule
+	Templated   bool
+	TriggerRule TriggerRule
 	Retries     int
 	RetryDelay  RetryDelay
+	Timeout     time.Duration
+	Pool        string
+	Priority    int
 	remaining   int
-	state       state
+	attempt     int
+	state       State
+	slots       *taskSlots
+	weight      int
 }
 
-type triggerRule string
+// A TriggerRule decides when a task runs, based on the states of the tasks
+// immediately upstream of it. A task whose trigger rule can no longer be met
+// is skipped.
+type TriggerRule string
 
 const (
-	allDone       triggerRule = "allDone"
-	allSuccessful triggerRule = "allSuccessful"
+	// AllSuccessful runs the task when all upstream tasks have succeeded.
+	// This is the default.
+	AllSuccessful TriggerRule = "allSuccessful"
+	// AllDone runs the task when all upstream tasks are done, whatever
+	// their state.
+	AllDone TriggerRule = "allDone"
+	// OneSuccess runs the task as soon as one upstream task has succeeded.
+	OneSuccess TriggerRule = "oneSuccess"
+	// OneFailed runs the task as soon as one upstream task has failed.
+	OneFailed TriggerRule = "oneFailed"
+	// AllFailed runs the task when all upstream tasks have failed.
+	AllFailed TriggerRule = "allFailed"
+	// NoneFailed runs the task when all upstream tasks are done and none
+	// of them failed, so they either succeeded or were skipped.
+	NoneFailed TriggerRule = "noneFailed"
+	// NoneSkipped runs the task when all upstream tasks are done and none
+	// of them were skipped.
+	NoneSkipped TriggerRule = "noneSkipped"
 )
 
-func (t *Task) run(writes chan writeOp) error {
+// A WeightRule decides the effective priority of the tasks of a job, when
+// they wait for a slot of the MaxRunningTasks or Pools options. Tasks with
+// a higher effective priority get their slots first.
+type WeightRule string
 
-	_, err := t.Operator.Run()
+const (
+	// WeightAbsolute uses the Priority of the task. This is the default.
+	WeightAbsolute WeightRule = "absolute"
+	// WeightDownstream adds the number of tasks downstream of the task to
+	// its Priority, so that the tasks that unblock the most work go first.
+	WeightDownstream WeightRule = "downstream"
+	// WeightUpstream adds the number of tasks upstream of the task to its
+	// Priority, so that executions that are further along finish first.
+	WeightUpstream WeightRule = "upstream"
+)
+
+// valid returns false if the weight rule is unknown.
+func (r WeightRule) valid() bool {
+	switch r {
+	case "", WeightAbsolute, WeightDownstream, WeightUpstream:
+		return true
+	}
+	return false
+}
+
+// valid returns false if the trigger rule is unknown.
+func (r TriggerRule) valid() bool {
+	switch r {
+	case AllSuccessful, AllDone, OneSuccess, OneFailed, AllFailed, NoneFailed, NoneSkipped:
+		return true
+	}
+	return false
+}
+
+// evaluate decides, given the states of the upstream tasks, whether a task
+// should run or be skipped. If neither is true, the task keeps waiting.
+func (r TriggerRule) evaluate(upstream []State) (run, skip bool) {
+	done, successes, failures, skips := 0, 0, 0, 0
+	for _, s := range upstream {
+		switch s {
+		case StateNotStarted, StateQueued, StateRunning, StateUpForRetry:
+			continue
+		case StateSuccessful:
+			successes++
+		case StateFailed:
+			failures++
+		case StateSkipped:
+			skips++
+		}
+		done++
+	}
+	allDone := done == len(upstream)
+
+	switch r {
+	case AllSuccessful:
+		run = successes == len(upstream)
+	case AllDone:
+		run = allDone
+	case OneSuccess:
+		run = successes > 0
+	case OneFailed:
+		run = failures > 0
+	case AllFailed:
+		run = allDone && failures == len(upstream)
+	case NoneFailed:
+		run = allDone && failures == 0
+	case NoneSkipped:
+		run = allDone && skips == 0
+	}
+
+	return run, allDone && !run
+}
+
+var errCancelled = errors.New("execution cancelled")
+
+func (t *Task) run(ctx context.Context, writes chan writeOp) error {
+
+	// wait for a slot in the task's pool
+	if t.slots != nil {
+		r := t.slots.request(t.Pool, t.weight)
+		select {
+		case <-r.granted:
+		default:
+			writes <- writeOp{key: t.Name, val: StateQueued}
+			select {
+			case <-r.granted:
+			case <-ctx.Done():
+				if t.slots.withdraw(r) {
+					writes <- writeOp{key: t.Name, val: StateCancelled, err: errCancelled.Error()}
+					return errCancelled
+				}
+			}
+		}
+		defer t.slots.release(t.Pool)
+	}
+
+	// the execution was cancelled before the task could start
+	if ctx.Err() != nil {
+		writes <- writeOp{key: t.Name, val: StateCancelled, err: errCancelled.Error()}
+		return errCancelled
+	}
+
+	// stop the operator once the timeout expires
+	taskCtx := ctx
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		taskCtx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	// render the templates in the operator's fields
+	op := t.Operator
+	var rendered map[string]string
+	var renderErr error
+	if t.Templated {
+		data := templateData(ctx)
+		data.Attempt = t.attempt
+		op, rendered, renderErr = renderOperator(t.Operator, data)
+	}
+
+	// record the start of the attempt
+	started := time.Now().UTC()
+	start := TaskAttempt{
+		Attempt:   t.attempt,
+		State:     StateRunning,
+		StartedAt: started.Format(time.RFC3339Nano),
+		Rendered:  rendered,
+	}
+	writes <- writeOp{key: t.Name, val: StateRunning, attempt: &start}
+
+	// collect the output of the operator
+	out := &taskOutput{}
+	taskCtx = context.WithValue(taskCtx, taskOutputKey, out)
+
+	var result interface{}
+	err := renderErr
+	if err == nil {
+		result, err = withContext(op).RunContext(taskCtx)
+	}
+
+	if err != nil && ctx.Err() != nil {
+		err = errCancelled
+	} else if err != nil && taskCtx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("task timed out after %v", t.Timeout)
+	}
+
+	ended := time.Now().UTC()
+	attempt := &TaskAttempt{
+		Attempt:    start.Attempt,
+		StartedAt:  start.StartedAt,
+		EndedAt:    ended.Format(time.RFC3339Nano),
+		DurationMs: ended.Sub(started).Milliseconds(),
+		Stdout:     out.stdout.String(),
+		Stderr:     out.stderr.String(),
+		ExitCode:   out.exitCode,
+		Rendered:   rendered,
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	// cancelled
+	if err == errCancelled {
+		attempt.State = StateCancelled
+		writes <- writeOp{key: t.Name, val: StateCancelled, err: err.Error(), attempt: attempt}
+		return err
+	}
 
 	// retry
 	if err != nil && t.remaining > 0 {
-		writes <- writeOp{t.Name, upForRetry}
+		attempt.State = StateUpForRetry
+		writes <- writeOp{key: t.Name, val: StateUpForRetry, err: err.Error(), attempt: attempt}
 		return nil
 	}
 
 	// failed
 	if err != nil && t.remaining <= 0 {
-		writes <- writeOp{t.Name, failed}
+		attempt.State = StateFailed
+		writes <- writeOp{key: t.Name, val: StateFailed, err: err.Error(), attempt: attempt}
 		return err
 	}
 
 	// success
-	writes <- writeOp{t.Name, successful}
+	attempt.State = StateSuccessful
+	writes <- writeOp{key: t.Name, val: StateSuccessful, result: result, attempt: attempt}
 	return nil
 }
 
-func (t *Task) skip(writes chan writeOp) error {
-	writes <- writeOp{t.Name, skipped}
-	return nil
+// retry waits for the retry delay and then runs the task again.
+func (t *Task) retry(ctx context.Context, writes chan writeOp, attempt int) error {
+	t.RetryDelay.wait(ctx, t.Name, attempt)
+	return t.run(ctx, writes)
 }
 
 // RetryDelay is a type that implements a Wait() method, which is called in between
 // task retry attempts.
 type RetryDelay interface {
-	wait(taskName string, attempt int)
+	wait(ctx context.Context, taskName string, attempt int)
 }
 
 // ConstantDelay waits a constant number of seconds between task retries.
 type ConstantDelay struct{ Period int }
 
-func (d ConstantDelay) wait(task string, attempt int) {
-	time.Sleep(time.Duration(d.Period) * time.Second)
+func (d ConstantDelay) wait(ctx context.Context, task string, attempt int) {
+	sleep(ctx, time.Duration(d.Period)*time.Second)
 }
 
 // ExponentialBackoff waits exponentially longer between each retry attempt.
 type ExponentialBackoff struct{}
 
-func (d ExponentialBackoff) wait(task string, attempt int) {
+func (d ExponentialBackoff) wait(ctx context.Context, task string, attempt int) {
 	delay := math.Pow(2, float64(attempt))
-	time.Sleep(time.Duration(delay) * time.Second)
+	sleep(ctx, time.Duration(delay)*time.Second)
+}
+
+// sleep pauses for the given duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
 }
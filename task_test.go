@@ -0,0 +1,54 @@
+package goflow
+
+import (
+	"testing"
+)
+
+type triggerRuleTest struct {
+	rule     TriggerRule
+	upstream []State
+	run      bool
+	skip     bool
+}
+
+var triggerRuleTests = []triggerRuleTest{
+	{AllSuccessful, []State{StateSuccessful, StateSuccessful}, true, false},
+	{AllSuccessful, []State{StateSuccessful, StateRunning}, false, false},
+	{AllSuccessful, []State{StateSuccessful, StateFailed}, false, true},
+	{AllDone, []State{StateFailed, StateSkipped}, true, false},
+	{AllDone, []State{StateFailed, StateUpForRetry}, false, false},
+	{OneSuccess, []State{StateSuccessful, StateRunning}, true, false},
+	{OneSuccess, []State{StateFailed, StateNotStarted}, false, false},
+	{OneSuccess, []State{StateFailed, StateSkipped}, false, true},
+	{OneFailed, []State{StateFailed, StateRunning}, true, false},
+	{OneFailed, []State{StateSuccessful, StateRunning}, false, false},
+	{OneFailed, []State{StateSuccessful, StateSkipped}, false, true},
+	{AllFailed, []State{StateFailed, StateFailed}, true, false},
+	{AllFailed, []State{StateFailed, StateRunning}, false, false},
+	{AllFailed, []State{StateFailed, StateSuccessful}, false, true},
+	{NoneFailed, []State{StateSuccessful, StateSkipped}, true, false},
+	{NoneFailed, []State{StateSuccessful, StateRunning}, false, false},
+	{NoneFailed, []State{StateSuccessful, StateFailed}, false, true},
+	{NoneSkipped, []State{StateSuccessful, StateFailed}, true, false},
+	{NoneSkipped, []State{StateSuccessful, StateNotStarted}, false, false},
+	{NoneSkipped, []State{StateSuccessful, StateSkipped}, false, true},
+}
+
+func TestTriggerRules(t *testing.T) {
+	for _, v := range triggerRuleTests {
+		run, skip := v.rule.evaluate(v.upstream)
+		if run != v.run || skip != v.skip {
+			t.Errorf("%v with upstream %v: got run=%t skip=%t, expected run=%t skip=%t",
+				v.rule, v.upstream, run, skip, v.run, v.skip)
+		}
+	}
+}
+
+func TestInvalidTriggerRule(t *testing.T) {
+	if TriggerRule("bla").valid() {
+		t.Errorf("Unknown trigger rule passed validation check")
+	}
+	if !OneSuccess.valid() {
+		t.Errorf("Valid trigger rule failed validation check")
+	}
+}
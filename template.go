@@ -0,0 +1,160 @@
+package goflow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateData is the data available to templates in the string fields of
+// the operator of a Templated task. For example, `{{.Params.date}}` is replaced with the value
+// of the date param, and `{{.Results.extract}}` with the result of the
+// upstream task named extract.
+type TemplateData struct {
+	// ExecutionID is the ID of the execution.
+	ExecutionID string
+	// JobName is the name of the job.
+	JobName string
+	// TaskName is the name of the task being run.
+	TaskName string
+	// Attempt is the number of the attempt, starting at 1.
+	Attempt int
+	// Submitted is the time the execution was submitted or scheduled.
+	Submitted time.Time
+	// IntervalStart and IntervalEnd are the bounds of the interval of the
+	// job's schedule covered by the execution. They are zero if the job
+	// has no schedule.
+	IntervalStart time.Time
+	IntervalEnd   time.Time
+	// Params are the runtime params of the execution.
+	Params map[string]interface{}
+	// Results are the results of the tasks immediately upstream of the
+	// task, keyed by task name.
+	Results map[string]interface{}
+}
+
+// newTemplateData builds the template data of a task from its execution.
+func newTemplateData(e *Execution, taskName string, results map[string]interface{}) TemplateData {
+	submitted, _ := time.Parse(time.RFC3339Nano, e.StartedAt)
+	intervalStart, _ := time.Parse(time.RFC3339, e.IntervalStart)
+	intervalEnd, _ := time.Parse(time.RFC3339, e.IntervalEnd)
+
+	// integral numbers decoded from JSON are rendered without an exponent
+	params := make(map[string]interface{})
+	for name, value := range e.Params {
+		if f, ok := value.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1e15 {
+			value = int64(f)
+		}
+		params[name] = value
+	}
+
+	return TemplateData{
+		ExecutionID:   e.ID.String(),
+		JobName:       e.JobName,
+		TaskName:      taskName,
+		Submitted:     submitted,
+		IntervalStart: intervalStart,
+		IntervalEnd:   intervalEnd,
+		Params:        params,
+		Results:       results,
+	}
+}
+
+// templateData returns the template data stored in the context of a task.
+func templateData(ctx context.Context) TemplateData {
+	data, _ := ctx.Value(templateDataKey).(TemplateData)
+	return data
+}
+
+// renderOperator returns a copy of the operator in which the templates in
+// the exported string and []string fields are rendered with the data.
+// The rendered values are returned keyed by field name, for auditing.
+// Fields without templates are left as they are.
+func renderOperator(o Operator, data TemplateData) (Operator, map[string]string, error) {
+	v := reflect.ValueOf(o)
+	isPtr := v.Kind() == reflect.Ptr
+	if isPtr {
+		if v.IsNil() {
+			return o, nil, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return o, nil, nil
+	}
+
+	cp := reflect.New(v.Type()).Elem()
+	cp.Set(v)
+
+	rendered := make(map[string]string)
+	for ix := 0; ix < cp.NumField(); ix++ {
+		field := cp.Type().Field(ix)
+		if !field.IsExported() {
+			continue
+		}
+
+		fv := cp.Field(ix)
+		switch {
+		case fv.Kind() == reflect.String:
+			s, ok, err := render(field.Name, fv.String(), data)
+			if err != nil {
+				return o, nil, err
+			}
+			if ok {
+				fv.SetString(s)
+				rendered[field.Name] = s
+			}
+
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String:
+			// copy the slice so the original operator is not modified
+			elems := reflect.MakeSlice(fv.Type(), fv.Len(), fv.Len())
+			reflect.Copy(elems, fv)
+			for jx := 0; jx < elems.Len(); jx++ {
+				name := fmt.Sprintf("%s[%d]", field.Name, jx)
+				s, ok, err := render(name, elems.Index(jx).String(), data)
+				if err != nil {
+					return o, nil, err
+				}
+				if ok {
+					elems.Index(jx).SetString(s)
+					rendered[name] = s
+				}
+			}
+			if !fv.IsNil() {
+				fv.Set(elems)
+			}
+		}
+	}
+
+	if len(rendered) == 0 {
+		return o, nil, nil
+	}
+	if isPtr {
+		return cp.Addr().Interface().(Operator), rendered, nil
+	}
+	return cp.Interface().(Operator), rendered, nil
+}
+
+// render executes text as a template. It returns false if the text
+// contains no template actions.
+func render(name, text string, data TemplateData) (string, bool, error) {
+	if !strings.Contains(text, "{{") {
+		return text, false, nil
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", false, fmt.Errorf("Invalid template in %s: %v", name, err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", false, fmt.Errorf("Failed to render %s: %v", name, err)
+	}
+	return out.String(), true, nil
+}
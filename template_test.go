@@ -0,0 +1,91 @@
+package goflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/philippgille/gokv/gomap"
+)
+
+type templatedOperator struct {
+	Path  string
+	Parts []string
+	Count int
+	note  string
+}
+
+func (o *templatedOperator) Run() (interface{}, error) {
+	return o.Path, nil
+}
+
+func TestRenderOperator(t *testing.T) {
+	e := &Execution{ID: uuid.New(), JobName: "render", Params: map[string]interface{}{"date": "2024-01-01", "n": float64(20240101)}}
+	data := newTemplateData(e, "task", map[string]interface{}{"upstream": "ok"})
+	data.Attempt = 2
+
+	parts := []string{"{{.JobName}}", "static", "{{.Results.upstream}}-{{.Attempt}}"}
+	o := &templatedOperator{Path: "/{{.Params.date}}/{{.Params.n}}", Parts: parts, note: "{{.TaskName}}"}
+
+	op, rendered, err := renderOperator(o, data)
+	if err != nil {
+		t.Fatalf("Got error %v, expected none", err)
+	}
+
+	r := op.(*templatedOperator)
+	if r.Path != "/2024-01-01/20240101" {
+		t.Errorf("Got path %q", r.Path)
+	}
+	if r.Parts[0] != "render" || r.Parts[1] != "static" || r.Parts[2] != "ok-2" {
+		t.Errorf("Got parts %v", r.Parts)
+	}
+	if r.note != "{{.TaskName}}" {
+		t.Errorf("Expected unexported fields to be left as they are")
+	}
+	if o.Path != "/{{.Params.date}}/{{.Params.n}}" || parts[0] != "{{.JobName}}" {
+		t.Errorf("Expected the original operator not to be modified")
+	}
+	if len(rendered) != 3 || rendered["Parts[2]"] != "ok-2" {
+		t.Errorf("Got rendered values %v", rendered)
+	}
+
+	if _, _, err := renderOperator(Command{Cmd: "{{.Params.missing}}"}, data); err == nil {
+		t.Errorf("Expected an error for a missing param")
+	}
+	if _, _, err := renderOperator(Command{Cmd: "{{.Params"}, data); err == nil {
+		t.Errorf("Expected an error for an invalid template")
+	}
+}
+
+func TestTemplatedTask(t *testing.T) {
+	j := &Job{Name: "templated", Schedule: "* * * * *"}
+	j.Add(&Task{Name: "first", Operator: Command{Cmd: "echo", Args: []string{"-n", "one"}}})
+	j.Add(&Task{Name: "second", Templated: true, Operator: Command{Cmd: "echo", Args: []string{"-n", "{{.Results.first}} {{.ExecutionID}}"}}})
+	j.Add(&Task{Name: "broken", Templated: true, Operator: Command{Cmd: "echo", Args: []string{"{{.Results.nope}}"}}})
+	j.Add(&Task{Name: "literal", Operator: Command{Cmd: "sh", Args: []string{"-c", "echo -n '{{.State.Status}}'"}}})
+	j.SetDownstream(j.Task("first"), j.Task("second"))
+	j.SetDownstream(j.Task("first"), j.Task("broken"))
+
+	store := NewKVStore(gomap.NewStore(gomap.DefaultOptions))
+	e := j.newExecution(nil)
+	j.run(context.Background(), store, e)
+
+	stored, _, _ := store.Get(e.ID)
+	for _, task := range stored.TaskExecutions {
+		switch task.Name {
+		case "second":
+			expected := "one " + e.ID.String()
+			if task.Result != expected || task.Attempts[0].Rendered["Args[1]"] != expected {
+				t.Errorf("Got result %v and rendered values %v", task.Result, task.Attempts[0].Rendered)
+			}
+		case "literal":
+			if task.Result != "{{.State.Status}}" || task.Attempts[0].Rendered != nil {
+				t.Errorf("Expected a task that is not templated to run its operator as it is, got %v", task.Result)
+			}
+		case "broken":
+			if task.State != StateFailed || task.Attempts[0].Error == "" {
+				t.Errorf("Expected a task with an invalid template to fail")
+			}
+		}
+	}
+}
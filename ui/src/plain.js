@@ -24,6 +24,79 @@ function jobPageEventHandler(message) {
   updateTaskStateCircles(d);
   updateGraphViz(d);
   updateLastRunTs(d);
+  updateRunningExecutions(d);
+  updateLastExecution(d);
+}
+
+// The most recently submitted execution of this job
+var lastExecution = null;
+
+function updateLastExecution(execution) {
+  if (lastExecution === null || execution.submitted >= lastExecution.submitted) {
+    lastExecution = execution;
+  }
+}
+
+async function showLogs(taskName) {
+  const logs = document.getElementById("logs");
+  const title = document.getElementById("logs-title");
+  if (lastExecution === null) {
+    logs.textContent = "This job has not run yet.";
+    return;
+  }
+
+  title.textContent = `Logs: ${taskName} (execution ${lastExecution.id})`;
+  const response = await fetch(`/api/executions/${lastExecution.id}/tasks/${taskName}/logs`);
+  const data = await response.json();
+
+  if (data.attempts.length === 0) {
+    logs.textContent = "This task has not run yet.";
+    return;
+  }
+
+  var text = "";
+  for (const a of data.attempts) {
+    text += `=== Attempt ${a.attempt}`;
+    if (a.exitCode !== undefined) {
+      text += ` (exit code ${a.exitCode})`;
+    }
+    text += " ===\n";
+    if (a.error) {
+      text += `Error: ${a.error}\n`;
+    }
+    text += `--- stdout ---\n${a.stdout || ""}\n`;
+    text += `--- stderr ---\n${a.stderr || ""}\n`;
+  }
+  logs.textContent = text;
+}
+
+// IDs of the executions of this job that are still running
+const runningExecutions = new Set();
+
+function updateRunningExecutions(execution) {
+  if (execution.state === "running" || execution.state === "notstarted") {
+    runningExecutions.add(execution.id);
+  } else {
+    runningExecutions.delete(execution.id);
+  }
+  const button = document.getElementById(`button-cancel-${execution.job}`);
+  button.disabled = runningExecutions.size === 0;
+}
+
+async function cancelRunning(jobName) {
+  var button = document.getElementById(`button-cancel-${jobName}`);
+  button.classList.add('clicked');
+
+  const options = {
+    method: 'POST'
+  }
+  for (const id of runningExecutions) {
+    await fetch(`/api/executions/${id}/cancel`, options)
+  }
+
+  setTimeout(function() {
+    button.classList.remove('clicked');
+  }, 200); // 200 milliseconds delay
 }
 
 function updateStateCircles(tableName, jobID, wrapperId, color, startTimestamp) {
@@ -101,6 +174,9 @@ function updateJobActive(jobName) {
 
 function stateColor(taskState) {
   switch (taskState) {
+    case "queued":
+      var color = "#f1e4fb";
+      break;
     case "running":
       var color = "#dffbe3";
       break;
@@ -116,6 +192,9 @@ function stateColor(taskState) {
     case "failed":
       var color = "#ff4020";
       break;
+    case "cancelled":
+      var color = "#a9a9a9";
+      break;
     case "notstarted":
       var color = "white";
       break;
@@ -139,3 +218,25 @@ async function buttonPress(buttonName, jobName) {
     button.classList.remove('clicked');
   }, 200); // 200 milliseconds delay
 }
+
+async function taskButtonPress(action, taskName) {
+  if (lastExecution === null) {
+    return;
+  }
+
+  var button = document.getElementById(`button-${action}-${taskName}`);
+  button.classList.add('clicked');
+
+  const options = {
+    method: 'POST'
+  }
+  if (action === 'mark') {
+    options.headers = { 'Content-Type': 'application/json' };
+    options.body = JSON.stringify({ state: 'successful' });
+  }
+  await fetch(`/api/executions/${lastExecution.id}/tasks/${taskName}/${action}`, options)
+
+  setTimeout(function() {
+    button.classList.remove('clicked');
+  }, 200); // 200 milliseconds delay
+}
@@ -11,3 +11,12 @@ func equal(a, b []string) bool {
 	}
 	return true
 }
+
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}